@@ -92,8 +92,10 @@ func main() {
 	// register the attach extension
 	tthr.Register("Attach", sshserver)
 
-	// register the toolbox extension
-	tthr.Register("Toolbox", tether.NewToolbox().InContainer())
+	// register the toolbox extension, which can have the tether apply an updated config
+	toolbox := tether.NewToolbox().InContainer()
+	toolbox.ApplyConfig = tthr.ApplyConfig
+	tthr.Register("Toolbox", toolbox)
 
 	err = tthr.Start()
 	if err != nil {
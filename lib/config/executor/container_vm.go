@@ -55,13 +55,17 @@ type Diagnostics struct {
 	// ExitLogs is a best effort record of the time of process death and the cause for
 	// restartable entities
 	ExitLogs []ExitLog `vic:"0.1" scope:"read-write" key:"exitlogs"`
+	// OOMKilled records whether the last exit of the process was a kill by the guest OOM killer
+	OOMKilled bool `vic:"0.1" scope:"read-write" key:"oomkilled"`
 }
 
 // ExitLog records some basic diagnostics about anomalous exit for restartable entities
 type ExitLog struct {
 	Time       time.Time
 	ExitStatus int
-	Message    string
+	// Signal is the number of the signal that killed the process, if any
+	Signal  int
+	Message string
 }
 
 // MountSpec details a mount that must be executed within the executor
@@ -137,6 +141,20 @@ type ExecutorConfig struct {
 	// Blob metadata for the caller
 	Annotations map[string]string `vic:"0.1" scope:"hidden" key:"annotations"`
 
+	// RestartCount is the number of times the container has been restarted by the caller's restart policy
+	RestartCount int `vic:"0.1" scope:"hidden" key:"restartcount"`
+
+	// ConfigVersion is the VM change version that the last reconfigure of this config was made against
+	ConfigVersion string `vic:"0.1" scope:"read-only" key:"configversion"`
+
+	// AppliedConfigVersion is published by the tether once it has applied the config carrying that ConfigVersion
+	AppliedConfigVersion string `vic:"0.1" scope:"read-write" key:"appliedconfigversion"`
+
+	// FailedConfigVersion and ConfigError are published by the tether if it could not apply the config
+	// carrying that ConfigVersion
+	FailedConfigVersion string `vic:"0.1" scope:"read-write" key:"failedconfigversion"`
+	ConfigError         string `vic:"0.1" scope:"read-write" key:"configerror"`
+
 	// Repository requested by user
 	// TODO: a bit docker specific
 	RepoName string `vic:"0.1" scope:"read-only" key:"repo"`
@@ -186,11 +204,64 @@ type SessionConfig struct {
 
 	Started string `vic:"0.1" scope:"read-write" key:"started"`
 
+	// Stopped is set by images that acknowledge a clean drain in response to a stop signal
+	Stopped string `vic:"0.1" scope:"read-write" key:"stopped"`
+
 	Restart bool `vic:"0.1" scope:"read-only" key:"restart"`
 
 	// StopSignal is the signal name or number used to stop container session
 	StopSignal string `vic:"0.1" scope:"read-only" key:"stopSignal"`
 
+	// ShutdownGuest selects a guest OS shutdown via tools, rather than kill signals, to stop the session
+	ShutdownGuest bool `vic:"0.1" scope:"read-only" key:"shutdownGuest"`
+
+	// NumericSignals sends signals to the guest by number rather than name, for guests that only accept numbers
+	NumericSignals bool `vic:"0.1" scope:"read-only" key:"numericSignals"`
+
+	// StopAck treats the Stopped key, in addition to power off, as confirmation of a clean stop
+	StopAck bool `vic:"0.1" scope:"read-only" key:"stopAck"`
+
+	// SignalAll stops every session concurrently rather than only the primary, set on the primary session
+	SignalAll bool `vic:"0.1" scope:"read-only" key:"signalAll"`
+
+	// StartPollInterval polls for the Started key at this interval on start rather than waiting on the
+	// property collector, if set
+	StartPollInterval time.Duration `vic:"0.1" scope:"read-only" key:"startPollInterval"`
+
+	// StartStabilize is how long the VM must stay powered on after the process launch for a start to
+	// succeed, if set
+	StartStabilize time.Duration `vic:"0.1" scope:"read-only" key:"startStabilize"`
+
+	// ReadyHeartbeat requires a green tools heartbeat, in addition to Started, for the container to be ready
+	ReadyHeartbeat bool `vic:"0.1" scope:"read-only" key:"readyHeartbeat"`
+
+	// FreezerPath is the guest freezer cgroup holding the session processes, used to freeze the container
+	FreezerPath string `vic:"0.1" scope:"read-only" key:"freezerPath"`
+
+	// CleanupCmd is a guest shell command run during the grace window after the stop signal is sent
+	CleanupCmd string `vic:"0.1" scope:"read-only" key:"cleanupCmd"`
+
+	// KillAttempts is how many times kill sends SIGKILL in the guest before a hard power off, default 1
+	KillAttempts int `vic:"0.1" scope:"read-only" key:"killAttempts"`
+
+	// ReadyKey is the guestinfo key the image publishes readiness on, if not the Started key
+	ReadyKey string `vic:"0.1" scope:"read-only" key:"readyKey"`
+
+	// SignalGroup sends stop signals to the process group of the session rather than only its process
+	SignalGroup bool `vic:"0.1" scope:"read-only" key:"signalGroup"`
+
+	// GuestUser is the username used to authenticate guest operations for the session, if not the session ID
+	GuestUser string `vic:"0.1" scope:"read-only" key:"guestUser"`
+
+	// ShutdownScript is a guest script run as the first step of shutdown, before any signal is sent
+	ShutdownScript string `vic:"0.1" scope:"read-only" key:"shutdownScript"`
+
+	// MigrationWait is how long start and stop wait for an in-progress migration to complete, not waiting if zero
+	MigrationWait time.Duration `vic:"0.1" scope:"read-only" key:"migrationWait"`
+
+	// SignalBroadcast has shutdown signal every guest process before a hard power off, for images without a reaping init
+	SignalBroadcast bool `vic:"0.1" scope:"read-only" key:"signalBroadcast"`
+
 	// Diagnostics holds basic diagnostics data
 	Diagnostics Diagnostics `vic:"0.1" scope:"read-only" key:"diagnostics"`
 
@@ -93,6 +93,8 @@ type Container struct {
 	ContainerNameConvention string
 	// Permitted datastore URLs for container storage for this virtual container host
 	ContainerStores []url.URL `vic:"0.1" scope:"read-only" recurse:"depth=0"`
+	// Maximum length of the arguments of programs started in containerVMs via guest tools, a default is used if unset
+	GuestArgsMax int `vic:"0.1" scope:"read-only" key:"guest_args_max"`
 }
 
 // RegistryConfig defines the registries virtual container host can talk to
@@ -18,14 +18,27 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 
 	"github.com/vmware/govmomi/guest"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
 	"github.com/vmware/govmomi/task"
+	"github.com/vmware/govmomi/vim25/methods"
 	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
 	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/cmd/tether/msgs"
 	"github.com/vmware/vic/lib/config/executor"
 	"github.com/vmware/vic/pkg/trace"
 	"github.com/vmware/vic/pkg/vsphere/extraconfig"
@@ -45,6 +58,254 @@ func (e NotYetExistError) Error() string {
 	return fmt.Sprintf("%s is not completely created", e.ID)
 }
 
+const (
+	// powerOffReserve is the portion of a stop deadline held back for the hard power off
+	powerOffReserve = 5 * time.Second
+
+	// minGraceWait is the least time worth waiting on a signal - with less left before the deadline
+	// signalling is skipped in favour of the hard power off
+	minGraceWait = time.Second
+
+	// abortStartTimeout bounds the power off issued when a start is cancelled
+	abortStartTimeout = 30 * time.Second
+
+	// powerStatePollWindow is the final stretch of a power state wait during which the state is polled
+	// directly, at powerStatePollInterval, in addition to waiting on the property collector
+	powerStatePollWindow   = 2 * time.Second
+	powerStatePollInterval = 250 * time.Millisecond
+
+	// startProgressInterval is how often startWithProgress reports progress
+	startProgressInterval = 2 * time.Second
+
+	// heartbeatPollInterval is how often the guest heartbeat status is checked while waiting on it
+	heartbeatPollInterval = time.Second
+
+	// migrationPollInterval is how often waitForMigration checks whether the migration has completed
+	migrationPollInterval = 2 * time.Second
+
+	// configAckPollInterval is how often waitForConfigAck checks whether the tether has applied the config
+	configAckPollInterval = time.Second
+
+	// configAckWait is how long setStopSignal waits for a running tether to apply the new stop signal
+	configAckWait = 10 * time.Second
+
+	// gonePollInterval is how often waitForGone checks whether the VM is still in inventory
+	gonePollInterval = time.Second
+
+	// guestInfoWait is how long to wait for tools to report guest information on a fresh container
+	guestInfoWait = 10 * time.Second
+
+	// defaultGuestArgsMax is the maximum length of guest program arguments if Config.GuestArgsMax is unset.
+	// Longer arguments are liable to be truncated by the guest process manager.
+	defaultGuestArgsMax = 64 * 1024
+
+	// maxDebugLevel is the highest diagnostics debug level acted on by the tether
+	maxDebugLevel = 3
+
+	// hardPowerOff is reported by shutdown when no signal stopped the container
+	hardPowerOff = "POWEROFF"
+
+	// stopMaxOperations and stopMaxDuration bound the vSphere operations issued by a single stop, with
+	// stopSessionOperations more allowed for each session as every session may be signalled twice. The
+	// final hard power off isn't counted against either.
+	stopMaxOperations     = 10
+	stopSessionOperations = 2
+	stopMaxDuration       = 5 * time.Minute
+)
+
+// StartAbortedError is returned when a start is cancelled after power on but before the process
+// launch was confirmed
+type StartAbortedError struct {
+	ID    string
+	Cause error
+
+	// RolledBack is true if the VM was successfully powered back off
+	RolledBack bool
+}
+
+func (e StartAbortedError) Error() string {
+	if e.RolledBack {
+		return fmt.Sprintf("start of %s aborted (%s), powered off", e.ID, e.Cause)
+	}
+	return fmt.Sprintf("start of %s aborted (%s), unable to power off", e.ID, e.Cause)
+}
+
+// VMInaccessibleError is returned when a lifecycle operation is attempted on a VM that vSphere reports as
+// not connected, e.g. inaccessible or orphaned after a storage event
+type VMInaccessibleError struct {
+	ID    string
+	State types.VirtualMachineConnectionState
+}
+
+func (e VMInaccessibleError) Error() string {
+	return fmt.Sprintf("%s is not accessible (connection state %s)", e.ID, e.State)
+}
+
+// HotAddNotSupportedError is returned when a device can't be added to a running container VM. The
+// operation may succeed if retried while the VM is powered off.
+type HotAddNotSupportedError struct {
+	ID  string
+	err error
+}
+
+func (e HotAddNotSupportedError) Error() string {
+	return fmt.Sprintf("hot add of device to %s not supported, power off and retry: %s", e.ID, e.err)
+}
+
+// GuestAuthError is returned when the guest rejects the credentials used for a guest operation
+type GuestAuthError struct {
+	ID  string
+	err error
+}
+
+func (e GuestAuthError) Error() string {
+	return fmt.Sprintf("guest authentication rejected for %s: %s", e.ID, e.err)
+}
+
+// StopExhaustedError is returned when a stop has used its operation budget without the container
+// powering off, rather than continuing to issue operations against vSphere. A container stop still
+// makes its final hard power off.
+type StopExhaustedError struct {
+	ID         string
+	Operations int
+	Elapsed    time.Duration
+}
+
+func (e StopExhaustedError) Error() string {
+	return fmt.Sprintf("stop of %s gave up after %d operations in %s", e.ID, e.Operations, e.Elapsed)
+}
+
+// stopBudget tracks the operations issued across the stop, shutdown and power off of a single stop
+type stopBudget struct {
+	mu sync.Mutex
+
+	id          string
+	start       time.Time
+	ops         int
+	maxOps      int
+	maxDuration time.Duration
+}
+
+type stopBudgetKey struct{}
+
+// newStopBudget returns the budget for a stop of the given number of sessions. An explicit waitTime
+// bounds each step of the stop itself, so the duration is only capped if the default wait is used.
+func newStopBudget(id string, sessions int, waitTime *int32) *stopBudget {
+	b := &stopBudget{
+		id:          id,
+		start:       time.Now(),
+		maxOps:      stopMaxOperations + stopSessionOperations*sessions,
+		maxDuration: stopMaxDuration,
+	}
+
+	if waitTime != nil && *waitTime > 0 {
+		b.maxDuration = 0
+	}
+
+	return b
+}
+
+// spend records an operation against the budget, returning StopExhaustedError if none remain
+func (b *stopBudget) spend(op string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	elapsed := time.Since(b.start)
+	if b.ops >= b.maxOps || (b.maxDuration > 0 && elapsed > b.maxDuration) {
+		return StopExhaustedError{ID: b.id, Operations: b.ops, Elapsed: elapsed}
+	}
+
+	b.ops++
+	log.Debugf("stop of %s: %s (operation %d of %d)", b.id, op, b.ops, b.maxOps)
+	return nil
+}
+
+// record counts an operation that is issued regardless of the budget, i.e. the hard power off that is
+// the last resort once the budget is spent
+func (b *stopBudget) record(op string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.ops++
+	log.Debugf("stop of %s: %s (operation %d, not limited)", b.id, op, b.ops)
+}
+
+// spendStopBudget records an operation against the stop budget carried by ctx, if any
+func spendStopBudget(ctx context.Context, op string) error {
+	if b, ok := ctx.Value(stopBudgetKey{}).(*stopBudget); ok {
+		return b.spend(op)
+	}
+	return nil
+}
+
+// recordStopOperation counts an operation exempt from the stop budget carried by ctx, if any
+func recordStopOperation(ctx context.Context, op string) {
+	if b, ok := ctx.Value(stopBudgetKey{}).(*stopBudget); ok {
+		b.record(op)
+	}
+}
+
+// GuestProgramNotFoundError is returned when a program launched in the guest doesn't exist there
+type GuestProgramNotFoundError struct {
+	ID   string
+	Path string
+	err  error
+}
+
+func (e GuestProgramNotFoundError) Error() string {
+	return fmt.Sprintf("guest program %s not found in %s: %s", e.Path, e.ID, e.err)
+}
+
+// ConfigApplyError is returned when the tether reports that it could not apply a config version
+type ConfigApplyError struct {
+	ID      string
+	Version string
+	Reason  string
+}
+
+func (e ConfigApplyError) Error() string {
+	return fmt.Sprintf("%s failed to apply config version %s: %s", e.ID, e.Version, e.Reason)
+}
+
+// guestInfoKey matches the ExtraConfig keys the guest is able to write
+var guestInfoKey = regexp.MustCompile(`^guestinfo\.[\w./|-]+$`)
+
+// PowerOffConfigFaultError is returned when a power off fails with a VM configuration fault, carrying the
+// readable reasons reported by vSphere
+type PowerOffConfigFaultError struct {
+	ID      string
+	Reasons []string
+	err     error
+}
+
+func (e PowerOffConfigFaultError) Error() string {
+	if len(e.Reasons) == 0 {
+		return fmt.Sprintf("power off of %s failed: %s", e.ID, e.err)
+	}
+	return fmt.Sprintf("power off of %s failed: %s", e.ID, strings.Join(e.Reasons, "; "))
+}
+
+// faultMessages returns the readable messages of the fault, falling back to the message key for any
+// without one
+func faultMessages(msgs []types.LocalizableMessage) []string {
+	var reasons []string
+	for _, m := range msgs {
+		if m.Message != "" {
+			reasons = append(reasons, m.Message)
+		} else {
+			reasons = append(reasons, m.Key)
+		}
+	}
+	return reasons
+}
+
+// SignalNumber returns the POSIX number of the ssh signal name, e.g. "TERM", or false if the signal isn't
+// known
+func SignalNumber(sig string) (int, bool) {
+	num, ok := msgs.Signals[ssh.Signal(sig)]
+	return num, ok
+}
+
 // containerBase holds fields common between Handle and Container. The fields and
 // methods in containerBase should not require locking as they're primary use is:
 // a. for read-only reference when used in Container
@@ -59,6 +320,18 @@ type containerBase struct {
 
 	// doesn't change so can be copied here
 	vm *vm.VirtualMachine
+
+	// optional logger carrying deployment specific fields - see logger()
+	logEntry *log.Entry
+
+	// optional callback observing the property collector round trip in updates - see setRefreshObserver()
+	refreshObserver func(time.Duration, error)
+
+	// what start does if the Started key never appears
+	startTimeoutPolicy StartTimeoutPolicy
+
+	// start returns once power on completes, without waiting for the Started key - see setWaitForStarted()
+	skipStartedWait bool
 }
 
 func newBase(vm *vm.VirtualMachine, c *types.VirtualMachineConfigInfo, r *types.VirtualMachineRuntimeInfo) *containerBase {
@@ -78,13 +351,75 @@ func newBase(vm *vm.VirtualMachine, c *types.VirtualMachineConfigInfo, r *types.
 	return base
 }
 
+// newBaseFromReference constructs a containerBase for an existing VM, fetching its config and runtime,
+// e.g. to reattach to containers after a restart
+func newBaseFromReference(ctx context.Context, vm *vm.VirtualMachine) (*containerBase, error) {
+	base := newBase(vm, nil, nil)
+	if err := base.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	return base, nil
+}
+
+// newBaseFromExtraConfig constructs a containerBase with no VM from the provided ExtraConfig, e.g. to
+// inspect historical config offline. Lifecycle operations on it return NotYetExistError.
+func newBaseFromExtraConfig(ec []types.BaseOptionValue) *containerBase {
+	return newBase(nil, &types.VirtualMachineConfigInfo{ExtraConfig: ec}, nil)
+}
+
+// hasVM returns true if the container has a backing VM
+func (c *containerBase) hasVM() bool {
+	return c.vm != nil
+}
+
+// reference returns the managed object reference of the container VM, or a zero reference if there
+// is no VM yet
+func (c *containerBase) reference() types.ManagedObjectReference {
+	if c.vm == nil {
+		return types.ManagedObjectReference{}
+	}
+	return c.vm.Reference()
+}
+
+// setLogger injects a logger, typically carrying preset fields, used for lifecycle logging
+func (c *containerBase) setLogger(entry *log.Entry) {
+	c.logEntry = entry
+}
+
+// setRefreshObserver injects a callback reporting the duration and outcome of the property fetch in each
+// updates/refresh, e.g. for latency histograms
+func (c *containerBase) setRefreshObserver(observer func(time.Duration, error)) {
+	c.refreshObserver = observer
+}
+
+// setStartTimeoutPolicy selects what start does with the VM if the process launch is never confirmed
+func (c *containerBase) setStartTimeoutPolicy(policy StartTimeoutPolicy) {
+	c.startTimeoutPolicy = policy
+}
+
+// setWaitForStarted selects whether start waits for the Started key after power on, which is the default.
+// Fire-and-forget launches that track readiness elsewhere can skip the wait.
+func (c *containerBase) setWaitForStarted(wait bool) {
+	c.skipStartedWait = !wait
+}
+
+// logger returns the injected logger if there is one, otherwise the package logger
+func (c *containerBase) logger() *log.Entry {
+	if c.logEntry != nil {
+		return c.logEntry
+	}
+
+	return log.NewEntry(log.StandardLogger())
+}
+
 // unlocked refresh of container state
 func (c *containerBase) refresh(ctx context.Context) error {
 	defer trace.End(trace.Begin(c.ExecConfig.ID))
 
 	base, err := c.updates(ctx)
 	if err != nil {
-		log.Errorf("Unable to update container %s", c.ExecConfig.ID)
+		c.logger().Errorf("Unable to update container %s", c.ExecConfig.ID)
 		return err
 	}
 
@@ -104,15 +439,29 @@ func (c *containerBase) updates(ctx context.Context) (*containerBase, error) {
 		return nil, NotYetExistError{c.ExecConfig.ID}
 	}
 
-	if err := c.vm.Properties(ctx, c.vm.Reference(), []string{"config", "runtime"}, &o); err != nil {
+	var began time.Time
+	if c.refreshObserver != nil {
+		began = time.Now()
+	}
+
+	err := c.vm.Properties(ctx, c.vm.Reference(), []string{"config", "runtime"}, &o)
+	if c.refreshObserver != nil {
+		c.refreshObserver(time.Since(began), err)
+	}
+	if err != nil {
 		return nil, err
 	}
 
 	base := &containerBase{
-		vm:         c.vm,
-		Config:     o.Config,
-		Runtime:    &o.Runtime,
-		ExecConfig: &executor.ExecutorConfig{},
+		vm:              c.vm,
+		Config:          o.Config,
+		Runtime:         &o.Runtime,
+		ExecConfig:      &executor.ExecutorConfig{},
+		logEntry:        c.logEntry,
+		refreshObserver: c.refreshObserver,
+
+		startTimeoutPolicy: c.startTimeoutPolicy,
+		skipStartedWait:    c.skipStartedWait,
 	}
 
 	// Get the ExtraConfig
@@ -121,211 +470,3457 @@ func (c *containerBase) updates(ctx context.Context) (*containerBase, error) {
 	return base, nil
 }
 
-func (c *containerBase) startGuestProgram(ctx context.Context, name string, args string) error {
+// commitExecConfig reconfigures the VM with the ExecConfig keys that differ from the ExtraConfig of the
+// last refresh, refreshing afterwards. The ChangeVersion of the last refresh gates the reconfigure.
+// Keys the guest writes are only committed while the VM is powered off, so a running tether's updates
+// aren't overwritten with the stale values read at refresh. Changes to keys visible to the guest are
+// stamped with the ChangeVersion and, if the VM is powered on, the tether is asked to apply them without
+// disturbing the running sessions; see waitForConfigAck. Hidden keys, e.g. the restart count, are only
+// committed.
+func (c *containerBase) commitExecConfig(ctx context.Context) error {
 	// make sure we have vm
 	if c.vm == nil {
 		return NotYetExistError{c.ExecConfig.ID}
 	}
 
 	defer trace.End(trace.Begin(c.ExecConfig.ID))
-	o := guest.NewOperationsManager(c.vm.Client.Client, c.vm.Reference())
-	m, err := o.ProcessManager(ctx)
-	if err != nil {
-		return err
-	}
 
-	spec := types.GuestProgramSpec{
-		ProgramPath: name,
-		Arguments:   args,
+	// we have to be certain of the power state to decide which keys can be written
+	if c.Config == nil || c.Runtime == nil {
+		return fmt.Errorf("refusing to reconfigure %s with incomplete runtime state", c.ExecConfig.ID)
 	}
 
-	auth := types.NamePasswordAuthentication{
-		Username: c.ExecConfig.ID,
+	poweredOff := c.Runtime.PowerState == types.VirtualMachinePowerStatePoweredOff
+	current := vmomi.OptionValueSource(c.Config.ExtraConfig)
+
+	changes := func() map[string]string {
+		cfg := make(map[string]string)
+		extraconfig.Encode(extraconfig.MapSink(cfg), c.ExecConfig)
+
+		for key, value := range cfg {
+			if v, err := current(key); err == nil && v == value {
+				delete(cfg, key)
+				continue
+			}
+
+			if !poweredOff && guestWritable(key) {
+				c.logger().Debugf("not committing guest owned key %s of %s while %s", key, c.ExecConfig.ID, c.Runtime.PowerState)
+				delete(cfg, key)
+			}
+		}
+		return cfg
 	}
 
-	_, err = m.StartProgram(ctx, &auth, &spec)
+	// poor man's test and set
+	changeVersion := c.Config.ChangeVersion
+	cfg := changes()
 
-	return err
-}
+	// only changes the tether can see are versioned for it to acknowledge, and only those warrant a reload
+	reload := false
+	for key := range cfg {
+		if strings.HasPrefix(key, extraconfig.DefaultGuestInfoPrefix) {
+			reload = true
+			break
+		}
+	}
 
-func (c *containerBase) start(ctx context.Context) error {
-	// make sure we have vm
-	if c.vm == nil {
-		return NotYetExistError{c.ExecConfig.ID}
+	if reload {
+		c.ExecConfig.ConfigVersion = changeVersion
+		cfg = changes()
+	}
+
+	spec := types.VirtualMachineConfigSpec{
+		ExtraConfig:   vmomi.OptionValueFromMap(cfg),
+		ChangeVersion: changeVersion,
 	}
 
-	// Power on
 	_, err := c.vm.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
-		return c.vm.PowerOn(ctx)
+		return c.vm.Reconfigure(ctx, spec)
 	})
 	if err != nil {
+		if f, ok := err.(types.HasFault); ok {
+			if _, ok := f.Fault().(*types.ConcurrentAccess); ok {
+				return ConcurrentAccessError{err}
+			}
+		}
 		return err
 	}
 
-	// guestinfo key that we want to wait for
-	key := extraconfig.CalculateKeys(c.ExecConfig, fmt.Sprintf("Sessions.%s.Started", c.ExecConfig.ID), "")[0]
-	var detail string
-
-	// Wait some before giving up...
-	ctx, cancel := context.WithTimeout(ctx, propertyCollectorTimeout)
-	defer cancel()
-
-	detail, err = c.vm.WaitForKeyInExtraConfig(ctx, key)
-	if err != nil {
-		return fmt.Errorf("unable to wait for process launch status: %s", err.Error())
+	if reload && c.Runtime.PowerState == types.VirtualMachinePowerStatePoweredOn {
+		// the config is committed regardless, and any failure to apply it is published by the tether
+		if err := c.startGuestProgram(ctx, "reload", ""); err != nil {
+			c.logger().Warnf("unable to apply config in %s: %s", c.ExecConfig.ID, err)
+		}
 	}
 
-	if detail != "true" {
-		return errors.New(detail)
-	}
+	return c.refresh(ctx)
+}
 
-	return nil
+// guestWritable reports whether the ExtraConfig key is read-write, i.e. one that the tether publishes to
+func guestWritable(key string) bool {
+	return strings.HasPrefix(key, extraconfig.DefaultGuestInfoPrefix) && !strings.Contains(key, "/")
 }
 
-func (c *containerBase) stop(ctx context.Context, waitTime *int32) error {
+// waitForConfigAck waits up to max for the tether to acknowledge that it has applied the config of the
+// reconfigure made against changeVersion, as recorded in ExecConfig.ConfigVersion by commitExecConfig.
+// A running tether acknowledges the change once commitExecConfig has had it apply the change, or reports
+// why it couldn't, returned as a ConfigApplyError. A powered off container has no tether to acknowledge
+// the change, which is applied when it next boots, so nothing is waited for.
+func (c *containerBase) waitForConfigAck(ctx context.Context, changeVersion string, max time.Duration) error {
 	// make sure we have vm
 	if c.vm == nil {
 		return NotYetExistError{c.ExecConfig.ID}
 	}
 
-	// get existing state and set to stopping
-	// if there's a failure we'll revert to existing
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
 
-	err := c.shutdown(ctx, waitTime)
-	if err == nil {
-		return nil
-	}
+	wctx, cancel := context.WithTimeout(ctx, max)
+	defer cancel()
 
-	log.Warnf("stopping %s via hard power off due to: %s", c.ExecConfig.ID, err)
+	ticker := time.NewTicker(configAckPollInterval)
+	defer ticker.Stop()
 
-	return c.poweroff(ctx)
-}
+	for {
+		// don't disturb the current view of the container while polling
+		base, err := c.updates(wctx)
+		if err != nil {
+			return err
+		}
 
-func (c *containerBase) kill(ctx context.Context) error {
-	// make sure we have vm
-	if c.vm == nil {
-		return NotYetExistError{c.ExecConfig.ID}
-	}
+		applied := base.ExecConfig.AppliedConfigVersion
+		if applied == changeVersion {
+			return nil
+		}
 
-	wait := 10 * time.Second // default
-	sig := string(ssh.SIGKILL)
-	log.Infof("sending kill -%s %s", sig, c.ExecConfig.ID)
+		if base.ExecConfig.FailedConfigVersion == changeVersion {
+			return ConfigApplyError{ID: c.ExecConfig.ID, Version: changeVersion, Reason: base.ExecConfig.ConfigError}
+		}
 
-	err := c.startGuestProgram(ctx, "kill", sig)
-	if err == nil {
-		log.Infof("waiting %s for %s to power off", wait, c.ExecConfig.ID)
-		timeout, err := c.waitForPowerState(ctx, wait, types.VirtualMachinePowerStatePoweredOff)
-		if err == nil {
-			return nil // VM has powered off
+		if base.Runtime.PowerState == types.VirtualMachinePowerStatePoweredOff {
+			c.logger().Debugf("%s is powered off, config version %s is applied on next power on", c.ExecConfig.ID, changeVersion)
+			return nil
 		}
 
-		if timeout {
-			log.Warnf("timeout (%s) waiting for %s to power off via SIG%s", wait, c.ExecConfig.ID, sig)
+		select {
+		case <-ticker.C:
+		case <-wctx.Done():
+			if ctx.Err() == nil {
+				return fmt.Errorf("timeout (%s) waiting for %s to apply config version %s (applied %q)", max, c.ExecConfig.ID, changeVersion, applied)
+			}
+			return ctx.Err()
 		}
 	}
+}
+
+// reconcileState corrects session state in ExtraConfig that's inconsistent with the actual power state,
+// e.g. sessions that still report running after a stop was interrupted before confirming power off
+func (c *containerBase) reconcileState(ctx context.Context) error {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
 
+	// work on a fresh copy so the current ExecConfig isn't modified in place
+	base, err := c.updates(ctx)
 	if err != nil {
-		log.Warnf("killing %s attempt resulted in: %s", c.ExecConfig.ID, err)
+		return err
 	}
 
-	log.Warnf("killing %s via hard power off", c.ExecConfig.ID)
-
-	return c.poweroff(ctx)
-}
+	if base.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOff {
+		*c = *base
+		return nil
+	}
 
-func (c *containerBase) shutdown(ctx context.Context, waitTime *int32) error {
-	// make sure we have vm
-	if c.vm == nil {
-		return NotYetExistError{c.ExecConfig.ID}
+	drift := false
+	now := time.Now().UTC().Unix()
+	for id, session := range base.ExecConfig.Sessions {
+		if session.Started == "true" && session.StopTime < session.StartTime {
+			c.logger().Infof("session %s of %s reports running but VM is powered off, recording stop", id, c.ExecConfig.ID)
+			session.StopTime = now
+			drift = true
+		}
 	}
 
-	wait := 10 * time.Second // default
-	if waitTime != nil && *waitTime > 0 {
-		wait = time.Duration(*waitTime) * time.Second
+	if drift {
+		if err := base.commitExecConfig(ctx); err != nil {
+			return err
+		}
 	}
 
-	cs := c.ExecConfig.Sessions[c.ExecConfig.ID]
-	stop := []string{cs.StopSignal, string(ssh.SIGKILL)}
-	if stop[0] == "" {
-		stop[0] = string(ssh.SIGTERM)
+	*c = *base
+	return nil
+}
+
+// diskPaths returns the backing file paths and capacities of the disks attached to the container VM,
+// refreshing Config first if it hasn't been fetched
+func (c *containerBase) diskPaths(ctx context.Context) ([]DiskInfo, error) {
+	if c.Config == nil {
+		if err := c.refresh(ctx); err != nil {
+			return nil, err
+		}
 	}
 
-	for _, sig := range stop {
-		msg := fmt.Sprintf("sending kill -%s %s", sig, c.ExecConfig.ID)
-		log.Info(msg)
+	disks := []DiskInfo{}
+	for _, device := range c.Config.Hardware.Device {
+		disk, ok := device.(*types.VirtualDisk)
+		if !ok {
+			continue
+		}
 
-		err := c.startGuestProgram(ctx, "kill", sig)
-		if err != nil {
-			return fmt.Errorf("%s: %s", msg, err)
+		info := DiskInfo{
+			CapacityKB: disk.CapacityInKB,
 		}
 
-		log.Infof("waiting %s for %s to power off", wait, c.ExecConfig.ID)
-		timeout, err := c.waitForPowerState(ctx, wait, types.VirtualMachinePowerStatePoweredOff)
-		if err == nil {
-			return nil // VM has powered off
+		if backing, ok := disk.Backing.(types.BaseVirtualDeviceFileBackingInfo); ok {
+			info.Path = backing.GetVirtualDeviceFileBackingInfo().FileName
 		}
 
-		if !timeout {
-			return err // error other than timeout
+		disks = append(disks, info)
+	}
+
+	return disks, nil
+}
+
+// resourceAllocation returns the configured CPU and memory reservations, limits and shares of the
+// container VM, refreshing Config first if it hasn't been fetched
+func (c *containerBase) resourceAllocation(ctx context.Context) (ResourceAllocation, error) {
+	if c.Config == nil {
+		if err := c.refresh(ctx); err != nil {
+			return ResourceAllocation{}, err
 		}
+	}
+
+	return ResourceAllocation{
+		CPU:    allocationSettings(c.Config.CpuAllocation),
+		Memory: allocationSettings(c.Config.MemoryAllocation),
+	}, nil
+}
+
+// allocationSettings converts the vSphere allocation info, treating an absent allocation as unlimited
+func allocationSettings(alloc types.BaseResourceAllocationInfo) AllocationSettings {
+	settings := AllocationSettings{Limit: -1}
+	if alloc == nil {
+		return settings
+	}
 
-		log.Warnf("timeout (%s) waiting for %s to power off via SIG%s", wait, c.ExecConfig.ID, sig)
+	info := alloc.GetResourceAllocationInfo()
+	settings.Reservation = info.Reservation
+	settings.Limit = info.Limit
+	if info.Shares != nil {
+		settings.Shares = info.Shares.Shares
+		settings.SharesLevel = info.Shares.Level
 	}
 
-	return fmt.Errorf("failed to shutdown %s via kill signals %s", c.ExecConfig.ID, stop)
+	return settings
 }
 
-func (c *containerBase) poweroff(ctx context.Context) error {
+// annotation returns the annotation of the container VM, refreshing Config first if it hasn't been fetched
+func (c *containerBase) annotation(ctx context.Context) (string, error) {
+	if c.Config == nil {
+		if err := c.refresh(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	return c.Config.Annotation, nil
+}
+
+// setAnnotation replaces the annotation of the container VM
+func (c *containerBase) setAnnotation(ctx context.Context, s string) error {
 	// make sure we have vm
 	if c.vm == nil {
 		return NotYetExistError{c.ExecConfig.ID}
 	}
 
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	spec := types.VirtualMachineConfigSpec{
+		Annotation: s,
+	}
+
 	_, err := c.vm.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
-		return c.vm.PowerOff(ctx)
+		return c.vm.Reconfigure(ctx, spec)
 	})
-
 	if err != nil {
+		return err
+	}
 
-		// It is possible the VM has finally shutdown in between, ignore the error in that case
-		if terr, ok := err.(task.Error); ok {
-			switch terr := terr.Fault().(type) {
-			case *types.InvalidPowerState:
-				if terr.ExistingState == types.VirtualMachinePowerStatePoweredOff {
-					log.Warnf("power off %s task skipped (state was already %s)", c.ExecConfig.ID, terr.ExistingState)
-					return nil
-				}
-				log.Warnf("invalid power state during power off: %s", terr.ExistingState)
-
-			case *types.GenericVmConfigFault:
-
-				// Check if the poweroff task was canceled due to a concurrent guest shutdown
-				if len(terr.FaultMessage) > 0 && terr.FaultMessage[0].Key == vmNotSuspendedKey {
-					log.Infof("power off %s task skipped due to guest shutdown", c.ExecConfig.ID)
-					return nil
-				}
-				log.Warnf("generic vm config fault during power off: %#v", terr)
+	return c.refresh(ctx)
+}
 
-			default:
-				log.Warnf("hard power off failed due to: %#v", terr)
-			}
+// bootDelay returns the delay between power on and the guest starting to boot, refreshing Config first
+// if it hasn't been fetched
+func (c *containerBase) bootDelay(ctx context.Context) (time.Duration, error) {
+	if c.Config == nil {
+		if err := c.refresh(ctx); err != nil {
+			return 0, err
 		}
+	}
 
-		return err
+	if c.Config.BootOptions == nil {
+		return 0, nil
 	}
 
-	return nil
+	return time.Duration(c.Config.BootOptions.BootDelay) * time.Millisecond, nil
 }
 
-func (c *containerBase) waitForPowerState(ctx context.Context, max time.Duration, state types.VirtualMachinePowerState) (bool, error) {
+// setBootDelay sets the delay between power on and the guest starting to boot, e.g. to sequence dependent
+// containers on the same host. The delay has millisecond granularity. A zero delay is omitted from the
+// reconfigure spec, so an existing delay can't be cleared via this.
+func (c *containerBase) setBootDelay(ctx context.Context, d time.Duration) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	ms := int64(d / time.Millisecond)
+	if ms < 0 {
+		return fmt.Errorf("invalid boot delay %s", d)
+	}
+
+	if ms == 0 {
+		current, err := c.bootDelay(ctx)
+		if err != nil {
+			return err
+		}
+
+		if current != 0 {
+			return fmt.Errorf("unable to clear boot delay of %s (currently %s)", c.ExecConfig.ID, current)
+		}
+		return nil
+	}
+
+	spec := types.VirtualMachineConfigSpec{
+		BootOptions: &types.VirtualMachineBootOptions{
+			BootDelay: ms,
+		},
+	}
+
+	_, err := c.vm.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
+		return c.vm.Reconfigure(ctx, spec)
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.refresh(ctx)
+}
+
+// setSessionEnv merges env into the environment of the session, to be applied by the tether on the next
+// start. The container must be powered off as environment changes have no effect on a running process.
+func (c *containerBase) setSessionEnv(ctx context.Context, sessionID string, env map[string]string) error {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	// work on a fresh copy so the current ExecConfig isn't modified in place
+	base, err := c.updates(ctx)
+	if err != nil {
+		return err
+	}
+
+	if base.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOff {
+		*c = *base
+		return fmt.Errorf("cannot update environment of %s while %s, environment is only applied at start", c.ExecConfig.ID, base.Runtime.PowerState)
+	}
+
+	session, ok := base.ExecConfig.Sessions[sessionID]
+	if !ok {
+		*c = *base
+		return fmt.Errorf("no session %s found in %s", sessionID, c.ExecConfig.ID)
+	}
+
+	session.Cmd.Env = mergeEnv(session.Cmd.Env, env)
+
+	if err := base.commitExecConfig(ctx); err != nil {
+		return err
+	}
+
+	*c = *base
+	return nil
+}
+
+// restartCount returns the number of times the container has been restarted, as recorded by
+// incrementRestartCount
+func (c *containerBase) restartCount(ctx context.Context) (int, error) {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if err := c.refresh(ctx); err != nil {
+		return 0, err
+	}
+
+	return c.ExecConfig.RestartCount, nil
+}
+
+// incrementRestartCount bumps the restart count stored with the container config. The reconfigure is
+// guarded by the change version so concurrent increments result in a ConcurrentAccessError rather than
+// a lost update.
+func (c *containerBase) incrementRestartCount(ctx context.Context) error {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	// work on a fresh copy so the current ExecConfig isn't modified in place
+	base, err := c.updates(ctx)
+	if err != nil {
+		return err
+	}
+
+	base.ExecConfig.RestartCount++
+
+	if err := base.commitExecConfig(ctx); err != nil {
+		return err
+	}
+
+	*c = *base
+	return nil
+}
+
+// setStopSignal changes the signal used to stop the session, taking effect on the next stop. The signal
+// may be given by name, with or without the SIG prefix, or by number. If the container is running this
+// waits briefly for the tether to apply the change, as the tether signals the session when it halts. The
+// tether applies it without disturbing the running session.
+func (c *containerBase) setStopSignal(ctx context.Context, sessionID string, sig string) error {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	sig, err := normalizeSignal(sig)
+	if err != nil {
+		return err
+	}
+
+	// work on a fresh copy so the current ExecConfig isn't modified in place
+	base, err := c.updates(ctx)
+	if err != nil {
+		return err
+	}
+
+	session, ok := base.ExecConfig.Sessions[sessionID]
+	if !ok {
+		*c = *base
+		return fmt.Errorf("no session %s found in %s", sessionID, c.ExecConfig.ID)
+	}
+
+	session.StopSignal = sig
+
+	if err := base.commitExecConfig(ctx); err != nil {
+		return err
+	}
+
+	*c = *base
+
+	if c.Runtime.PowerState == types.VirtualMachinePowerStatePoweredOn {
+		// the port layer reads the new signal regardless, so a tether that's slow to apply it isn't fatal,
+		// but one that has rejected it won't use it when it halts the session
+		err := c.waitForConfigAck(ctx, c.ExecConfig.ConfigVersion, configAckWait)
+		if _, ok := err.(ConfigApplyError); ok {
+			return err
+		}
+		if err != nil {
+			c.logger().Warnf("stop signal of %s may not be applied by the tether yet: %s", sessionID, err)
+		}
+	}
+
+	return nil
+}
+
+// normalizeSignal validates sig against the known signals, returning the name without the SIG prefix, or
+// the number if given as a number
+func normalizeSignal(sig string) (string, error) {
+	if sig == "" {
+		return "", errors.New("signal must not be empty")
+	}
+
+	if num, err := strconv.Atoi(sig); err == nil {
+		for _, n := range msgs.Signals {
+			if n == num {
+				return sig, nil
+			}
+		}
+		return "", fmt.Errorf("unknown signal number %d", num)
+	}
+
+	name := strings.TrimPrefix(strings.ToUpper(sig), "SIG")
+	if _, ok := SignalNumber(name); !ok {
+		return "", fmt.Errorf("unknown signal %q", sig)
+	}
+
+	return name, nil
+}
+
+// setDebugLevel updates the diagnostics debug level of the tether, which is applied without a restart
+func (c *containerBase) setDebugLevel(ctx context.Context, level int) error {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if level < 0 || level > maxDebugLevel {
+		return fmt.Errorf("debug level %d out of range 0-%d", level, maxDebugLevel)
+	}
+
+	// work on a fresh copy so the current ExecConfig isn't modified in place
+	base, err := c.updates(ctx)
+	if err != nil {
+		return err
+	}
+
+	base.ExecConfig.Diagnostics.DebugLevel = level
+
+	if err := base.commitExecConfig(ctx); err != nil {
+		if terr, ok := err.(task.Error); ok {
+			switch terr.Fault().(type) {
+			case *types.InvalidPowerState, *types.InvalidState:
+				return fmt.Errorf("unable to change debug level of %s in its current state (%s): %s", c.ExecConfig.ID, base.Runtime.PowerState, err)
+			}
+		}
+		return err
+	}
+
+	c.logger().Infof("set debug level of %s to %d", c.ExecConfig.ID, level)
+
+	*c = *base
+	return nil
+}
+
+// mergeEnv returns env in KEY=value form with the values in updates replacing any existing entries for
+// the same key. New keys are appended in sorted order.
+func mergeEnv(env []string, updates map[string]string) []string {
+	merged := make([]string, 0, len(env)+len(updates))
+	seen := make(map[string]bool, len(updates))
+
+	for _, kv := range env {
+		key := strings.SplitN(kv, "=", 2)[0]
+		if val, ok := updates[key]; ok {
+			kv = key + "=" + val
+			seen[key] = true
+		}
+		merged = append(merged, kv)
+	}
+
+	var keys []string
+	for key := range updates {
+		if !seen[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		merged = append(merged, key+"="+updates[key])
+	}
+
+	return merged
+}
+
+// command returns the configured argv and working directory of the session
+func (c *containerBase) command(sessionID string) ([]string, string, error) {
+	session, ok := c.ExecConfig.Sessions[sessionID]
+	if !ok {
+		return nil, "", fmt.Errorf("no session %s found in %s", sessionID, c.ExecConfig.ID)
+	}
+
+	return session.Cmd.Args, session.Cmd.Dir, nil
+}
+
+// diff returns a readable description of the differences in power state, sessions and key config between
+// the receiver and other, in that order
+func (c *containerBase) diff(other *containerBase) []string {
+	var changes []string
+
+	var before, after types.VirtualMachinePowerState
+	if c.Runtime != nil {
+		before = c.Runtime.PowerState
+	}
+	if other.Runtime != nil {
+		after = other.Runtime.PowerState
+	}
+	if before != after {
+		changes = append(changes, fmt.Sprintf("power state %s -> %s", before, after))
+	}
+
+	var ids []string
+	for id := range c.ExecConfig.Sessions {
+		ids = append(ids, id)
+	}
+	for id := range other.ExecConfig.Sessions {
+		if _, ok := c.ExecConfig.Sessions[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		a, inBefore := c.ExecConfig.Sessions[id]
+		b, inAfter := other.ExecConfig.Sessions[id]
+
+		switch {
+		case !inAfter:
+			changes = append(changes, fmt.Sprintf("session %s removed", id))
+		case !inBefore:
+			changes = append(changes, fmt.Sprintf("session %s added", id))
+		case a.Started != b.Started:
+			changes = append(changes, fmt.Sprintf("session %s started %q -> %q", id, a.Started, b.Started))
+		}
+	}
+
+	var ca, cb types.VirtualMachineConfigInfo
+	if c.Config != nil {
+		ca = *c.Config
+	}
+	if other.Config != nil {
+		cb = *other.Config
+	}
+
+	if ca.ChangeVersion != cb.ChangeVersion {
+		changes = append(changes, fmt.Sprintf("config version %s -> %s", ca.ChangeVersion, cb.ChangeVersion))
+	}
+	if ca.Hardware.NumCPU != cb.Hardware.NumCPU {
+		changes = append(changes, fmt.Sprintf("cpus %d -> %d", ca.Hardware.NumCPU, cb.Hardware.NumCPU))
+	}
+	if ca.Hardware.MemoryMB != cb.Hardware.MemoryMB {
+		changes = append(changes, fmt.Sprintf("memory %dMB -> %dMB", ca.Hardware.MemoryMB, cb.Hardware.MemoryMB))
+	}
+	if ca.Annotation != cb.Annotation {
+		changes = append(changes, "annotation changed")
+	}
+
+	return changes
+}
+
+// extraConfigValue returns the raw value of the ExtraConfig key from the last refresh
+func (c *containerBase) extraConfigValue(key string) (string, bool) {
+	if c.Config == nil {
+		return "", false
+	}
+
+	for _, bov := range c.Config.ExtraConfig {
+		ov := bov.GetOptionValue()
+		if ov.Key == key {
+			value, _ := ov.Value.(string)
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// startedKey returns the guestinfo key the tether uses to report the launch status of the session
+func (c *containerBase) startedKey(id string) string {
+	return extraconfig.CalculateKeys(c.ExecConfig, fmt.Sprintf("Sessions.%s.Started", id), "")[0]
+}
+
+// readyKey returns the key the session publishes readiness on - the one declared by the session if any,
+// otherwise its Started key
+func (c *containerBase) readyKey(id string) (string, error) {
+	cs, ok := c.ExecConfig.Sessions[id]
+	if !ok || cs.ReadyKey == "" {
+		return c.startedKey(id), nil
+	}
+
+	if !guestInfoKey.MatchString(cs.ReadyKey) {
+		return "", fmt.Errorf("readiness key %q of session %s is not a valid guestinfo key", cs.ReadyKey, id)
+	}
+
+	return cs.ReadyKey, nil
+}
+
+// isReady reports whether the container is powered on and the primary session has started, evaluating
+// both from the same refresh so the answer is consistent
+func (c *containerBase) isReady(ctx context.Context) (bool, error) {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if err := c.refresh(ctx); err != nil {
+		return false, err
+	}
+
+	if c.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOn {
+		return false, nil
+	}
+
+	detail, _ := c.extraConfigValue(c.startedKey(c.ExecConfig.ID))
+	if detail != "true" {
+		return false, nil
+	}
+
+	if cs, ok := c.ExecConfig.Sessions[c.ExecConfig.ID]; ok && cs.ReadyHeartbeat {
+		status, err := c.heartbeatStatus(ctx)
+		if err != nil {
+			return false, err
+		}
+		return status == types.ManagedEntityStatusGreen, nil
+	}
+
+	return true, nil
+}
+
+// heartbeatStatus returns the current guest tools heartbeat status of the container VM
+func (c *containerBase) heartbeatStatus(ctx context.Context) (types.ManagedEntityStatus, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return "", NotYetExistError{c.ExecConfig.ID}
+	}
+
+	var o mo.VirtualMachine
+	if err := c.vm.Properties(ctx, c.vm.Reference(), []string{"guestHeartbeatStatus"}, &o); err != nil {
+		return "", err
+	}
+
+	return o.GuestHeartbeatStatus, nil
+}
+
+// waitForHeartbeat polls the guest heartbeat status until it reaches status, returning an error if it
+// hasn't within max
+func (c *containerBase) waitForHeartbeat(ctx context.Context, max time.Duration, status types.ManagedEntityStatus) error {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	wctx, cancel := context.WithTimeout(ctx, max)
+	defer cancel()
+
+	ticker := time.NewTicker(heartbeatPollInterval)
+	defer ticker.Stop()
+
+	for {
+		current, err := c.heartbeatStatus(wctx)
+		if err != nil {
+			return err
+		}
+
+		if current == status {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-wctx.Done():
+			if ctx.Err() == nil {
+				return fmt.Errorf("timeout (%s) waiting for %s heartbeat to reach %s (last %s)", max, c.ExecConfig.ID, status, current)
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// sessionStates returns a point-in-time view of whether each session in the container reports Started
+func (c *containerBase) sessionStates(ctx context.Context) (map[string]bool, error) {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if err := c.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]bool, len(c.ExecConfig.Sessions))
+	for id := range c.ExecConfig.Sessions {
+		detail, _ := c.extraConfigValue(c.startedKey(id))
+		states[id] = detail == "true"
+	}
+
+	return states, nil
+}
+
+// exitInfo returns the exit status of the primary session as published by the tether, and whether the
+// tether found that the process was killed by the guest OOM killer
+func (c *containerBase) exitInfo(ctx context.Context) (int32, bool, error) {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if err := c.refresh(ctx); err != nil {
+		return 0, false, err
+	}
+
+	session, ok := c.ExecConfig.Sessions[c.ExecConfig.ID]
+	if !ok {
+		return 0, false, fmt.Errorf("no primary session found for %s", c.ExecConfig.ID)
+	}
+
+	if session.Started == "" {
+		return 0, false, fmt.Errorf("%s has not been started", c.ExecConfig.ID)
+	}
+
+	return int32(session.ExitStatus), session.Diagnostics.OOMKilled, nil
+}
+
+// lastExitReason returns how the previous instance of an auto-restarted primary session exited, from the
+// exit logs published by the tether. The signal is empty if the process exited rather than being killed.
+func (c *containerBase) lastExitReason(ctx context.Context) (int32, string, error) {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if err := c.refresh(ctx); err != nil {
+		return 0, "", err
+	}
+
+	session, ok := c.ExecConfig.Sessions[c.ExecConfig.ID]
+	if !ok {
+		return 0, "", fmt.Errorf("no primary session found for %s", c.ExecConfig.ID)
+	}
+
+	logs := session.Diagnostics.ExitLogs
+	if len(logs) == 0 {
+		return 0, "", fmt.Errorf("no previous exit recorded for %s", c.ExecConfig.ID)
+	}
+
+	last := logs[len(logs)-1]
+	return int32(last.ExitStatus), signalName(last.Signal), nil
+}
+
+// signalName returns the name of the signal with the given number, the number itself if the signal isn't
+// known, or empty for no signal
+func signalName(num int) string {
+	if num == 0 {
+		return ""
+	}
+
+	for sig, n := range msgs.Signals {
+		if n == num {
+			return string(sig)
+		}
+	}
+
+	return strconv.Itoa(num)
+}
+
+// resourceUsage returns the overall CPU (MHz) and guest memory (MB) usage of the container VM as sampled
+// in the quick stats. Runtime is updated from the same fetch.
+func (c *containerBase) resourceUsage(ctx context.Context) (int32, int32, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return 0, 0, NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	var o mo.VirtualMachine
+	if err := c.vm.Properties(ctx, c.vm.Reference(), []string{"runtime", "summary.quickStats"}, &o); err != nil {
+		return 0, 0, err
+	}
+
+	c.Runtime = &o.Runtime
+
+	stats := o.Summary.QuickStats
+	if stats.OverallCpuUsage == 0 && stats.GuestMemoryUsage == 0 {
+		return 0, 0, fmt.Errorf("resource usage for %s not yet available (power state %s)", c.ExecConfig.ID, o.Runtime.PowerState)
+	}
+
+	return stats.OverallCpuUsage, stats.GuestMemoryUsage, nil
+}
+
+// guestSignal returns the signal in the form the guest expects - by number if the primary session
+// requests numeric signals, otherwise unchanged
+func (c *containerBase) guestSignal(sig string) string {
+	cs, ok := c.ExecConfig.Sessions[c.ExecConfig.ID]
+	if !ok || !cs.NumericSignals {
+		return sig
+	}
+
+	if num, ok := SignalNumber(sig); ok {
+		return strconv.Itoa(num)
+	}
+
+	return sig
+}
+
+// stopSignalArg returns the kill argument used by shutdown for the signal, in the process group form
+// understood by the tether if the primary session requests it
+func (c *containerBase) stopSignalArg(sig string) string {
+	arg := c.guestSignal(sig)
+	if cs, ok := c.ExecConfig.Sessions[c.ExecConfig.ID]; ok && cs.SignalGroup {
+		return "-" + arg
+	}
+	return arg
+}
+
+// signalPID sends sig to the guest process with the given pid, e.g. a child process of a session, rather
+// than to a session itself
+func (c *containerBase) signalPID(ctx context.Context, pid int64, sig string) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if pid <= 0 {
+		return fmt.Errorf("invalid pid %d", pid)
+	}
+
+	sig, err := normalizeSignal(sig)
+	if err != nil {
+		return err
+	}
+
+	c.logger().Infof("sending kill -%s to pid %d in %s", sig, pid, c.ExecConfig.ID)
+
+	return c.startGuestProgram(ctx, "kill", fmt.Sprintf("%s pid:%d", c.guestSignal(sig), pid))
+}
+
+// broadcastSignalArg returns the kill arguments that send sig to every process in the guest other than
+// the tether, as with kill -1
+func (c *containerBase) broadcastSignalArg(sig string) string {
+	return c.guestSignal(sig) + " pid:-1"
+}
+
+// connectionState returns the current connection state of the container VM
+func (c *containerBase) connectionState(ctx context.Context) (types.VirtualMachineConnectionState, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return "", NotYetExistError{c.ExecConfig.ID}
+	}
+
+	var o mo.VirtualMachine
+	if err := c.vm.Properties(ctx, c.vm.Reference(), []string{"runtime.connectionState"}, &o); err != nil {
+		return "", err
+	}
+
+	return o.Runtime.ConnectionState, nil
+}
+
+// checkAccessible returns a VMInaccessibleError if the container VM isn't connected
+func (c *containerBase) checkAccessible(ctx context.Context) error {
+	state, err := c.connectionState(ctx)
+	if err != nil {
+		return err
+	}
+
+	if state != types.VirtualMachineConnectionStateConnected {
+		return VMInaccessibleError{ID: c.ExecConfig.ID, State: state}
+	}
+
+	return nil
+}
+
+// uptime returns how long the container VM has been powered on, based on the boot time in Runtime.
+// Runtime is refreshed first.
+func (c *containerBase) uptime(ctx context.Context) (time.Duration, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return 0, NotYetExistError{c.ExecConfig.ID}
+	}
+
+	var o mo.VirtualMachine
+	if err := c.vm.Properties(ctx, c.vm.Reference(), []string{"runtime"}, &o); err != nil {
+		return 0, err
+	}
+
+	c.Runtime = &o.Runtime
+
+	if o.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOn {
+		return 0, fmt.Errorf("%s is not powered on (power state %s)", c.ExecConfig.ID, o.Runtime.PowerState)
+	}
+
+	if o.Runtime.BootTime == nil {
+		return 0, fmt.Errorf("boot time of %s not available", c.ExecConfig.ID)
+	}
+
+	return time.Since(*o.Runtime.BootTime), nil
+}
+
+// toolsVersion returns the guest tools version and running status, which differ in shutdown behavior
+// between the open-vm-tools and legacy tools variants
+func (c *containerBase) toolsVersion(ctx context.Context) (string, string, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return "", "", NotYetExistError{c.ExecConfig.ID}
+	}
+
+	var o mo.VirtualMachine
+	if err := c.vm.Properties(ctx, c.vm.Reference(), []string{"guest.toolsVersion", "guest.toolsRunningStatus"}, &o); err != nil {
+		return "", "", err
+	}
+
+	if o.Guest == nil {
+		return "", "", nil
+	}
+
+	return o.Guest.ToolsVersion, o.Guest.ToolsRunningStatus, nil
+}
+
+// waitForTools waits up to max for guest tools to report that they're running, returning an error
+// if they don't start in that time
+func (c *containerBase) waitForTools(ctx context.Context, max time.Duration) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	wctx, cancel := context.WithTimeout(ctx, max)
+	defer cancel()
+
+	running := string(types.VirtualMachineToolsRunningStatusGuestToolsRunning)
+
+	p := property.DefaultCollector(c.vm.Vim25())
+	err := property.Wait(wctx, p, c.vm.Reference(), []string{"guest.toolsRunningStatus"}, func(pc []types.PropertyChange) bool {
+		for _, change := range pc {
+			if status, ok := change.Val.(string); ok && status == running {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		if wctx.Err() != nil && ctx.Err() == nil {
+			return fmt.Errorf("guest tools never started in %s (waited %s)", c.ExecConfig.ID, max)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// guestHostname returns the hostname reported by guest tools, waiting briefly for it to be reported.
+// An empty string is returned without error if tools haven't reported it yet.
+func (c *containerBase) guestHostname(ctx context.Context) (string, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return "", NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	wctx, cancel := context.WithTimeout(ctx, guestInfoWait)
+	defer cancel()
+
+	var hostname string
+
+	p := property.DefaultCollector(c.vm.Vim25())
+	err := property.Wait(wctx, p, c.vm.Reference(), []string{"guest.hostName"}, func(pc []types.PropertyChange) bool {
+		for _, change := range pc {
+			if name, ok := change.Val.(string); ok && name != "" {
+				hostname = name
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		if wctx.Err() != nil && ctx.Err() == nil {
+			c.logger().Debugf("guest hostname not yet reported for %s", c.ExecConfig.ID)
+			return "", nil
+		}
+		return "", err
+	}
+
+	return hostname, nil
+}
+
+// waitForRoutableIP waits up to max for the guest to report a routable IPv4 address, i.e. one that's
+// neither loopback nor link-local, and returns the first found. The error on timeout lists the addresses
+// that were reported.
+func (c *containerBase) waitForRoutableIP(ctx context.Context, max time.Duration) (string, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return "", NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	wctx, cancel := context.WithTimeout(ctx, max)
+	defer cancel()
+
+	var ip string
+	var seen []string
+
+	p := property.DefaultCollector(c.vm.Vim25())
+	err := property.Wait(wctx, p, c.vm.Reference(), []string{"guest.net"}, func(pc []types.PropertyChange) bool {
+		for _, change := range pc {
+			nics, ok := change.Val.(types.ArrayOfGuestNicInfo)
+			if !ok {
+				continue
+			}
+
+			seen = nil
+			for _, nic := range nics.GuestNicInfo {
+				seen = append(seen, nic.IpAddress...)
+			}
+
+			if ip = routableIPv4(seen); ip != "" {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		if wctx.Err() != nil && ctx.Err() == nil {
+			return "", fmt.Errorf("timeout (%s) waiting for a routable IP in %s, addresses seen: [%s]", max, c.ExecConfig.ID, strings.Join(seen, ", "))
+		}
+		return "", err
+	}
+
+	return ip, nil
+}
+
+// routableIPv4 returns the first address that's an IPv4 address other than loopback or link-local
+func routableIPv4(addrs []string) string {
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil || ip.To4() == nil {
+			continue
+		}
+
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+			continue
+		}
+
+		return addr
+	}
+	return ""
+}
+
+// guestAuth returns the credentials used for guest process manager operations
+func (c *containerBase) guestAuth() *types.NamePasswordAuthentication {
+	return c.sessionAuth(c.ExecConfig.ID)
+}
+
+// sessionAuth returns the credentials used for guest process manager operations targeting a session -
+// the guest user configured for the session, or the session ID
+func (c *containerBase) sessionAuth(id string) *types.NamePasswordAuthentication {
+	username := id
+	if cs, ok := c.ExecConfig.Sessions[id]; ok && cs.GuestUser != "" {
+		username = cs.GuestUser
+	}
+
+	return &types.NamePasswordAuthentication{
+		Username: username,
+	}
+}
+
+func (c *containerBase) processManager(ctx context.Context) (*guest.ProcessManager, error) {
+	o := guest.NewOperationsManager(c.vm.Client.Client, c.vm.Reference())
+	return o.ProcessManager(ctx)
+}
+
+func (c *containerBase) startGuestProgram(ctx context.Context, name string, args string) error {
+	_, err := c.launchGuestProgram(ctx, name, args)
+	return err
+}
+
+// launchGuestProgram starts the program in the guest and returns the pid of the launched process
+func (c *containerBase) launchGuestProgram(ctx context.Context, name string, args string) (int64, error) {
+	return c.launchSessionProgram(ctx, c.ExecConfig.ID, name, args)
+}
+
+// launchSessionProgram starts the program in the guest on behalf of the session and returns the pid
+// of the launched process
+func (c *containerBase) launchSessionProgram(ctx context.Context, id string, name string, args string) (int64, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return 0, NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(id))
+
+	if err := checkGuestArgs(name, args); err != nil {
+		return 0, err
+	}
+
+	m, err := c.processManager(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	spec := types.GuestProgramSpec{
+		ProgramPath: name,
+		Arguments:   args,
+	}
+
+	pid, err := m.StartProgram(ctx, c.sessionAuth(id), &spec)
+	if err != nil {
+		if soap.IsSoapFault(err) {
+			switch soap.ToSoapFault(err).VimFault().(type) {
+			case types.FileNotFound, types.FileFault:
+				return 0, GuestProgramNotFoundError{ID: c.ExecConfig.ID, Path: name, err: err}
+			}
+		}
+		return 0, c.guestProgramError(err)
+	}
+
+	return pid, nil
+}
+
+// checkGuestArgs rejects guest program arguments longer than the configured maximum, which would otherwise
+// fail opaquely in the guest
+func checkGuestArgs(name string, args string) error {
+	max := Config.GuestArgsMax
+	if max <= 0 {
+		max = defaultGuestArgsMax
+	}
+
+	if len(args) > max {
+		return fmt.Errorf("arguments to guest program %s are %d bytes, exceeding the maximum of %d", name, len(args), max)
+	}
+
+	return nil
+}
+
+// guestProgramError wraps known guest operation faults in errors that callers can act on
+func (c *containerBase) guestProgramError(err error) error {
+	if !soap.IsSoapFault(err) {
+		return err
+	}
+
+	switch soap.ToSoapFault(err).VimFault().(type) {
+	case types.InvalidGuestLogin:
+		return GuestAuthError{ID: c.ExecConfig.ID, err: err}
+	}
+
+	return err
+}
+
+// verifyGuestOps has the tether run its no-op command to confirm the guest process manager is usable,
+// and therefore whether kill based shutdown can be expected to work for this container. The tether
+// handles the command itself rather than launching a process, so there is no exit code to poll for.
+func (c *containerBase) verifyGuestOps(ctx context.Context) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if err := c.waitForTools(ctx, guestInfoWait); err != nil {
+		return err
+	}
+
+	err := c.startGuestProgram(ctx, "true", "")
+	switch err.(type) {
+	case nil, GuestAuthError, GuestProgramNotFoundError:
+		return err
+	}
+
+	if soap.IsSoapFault(err) {
+		switch soap.ToSoapFault(err).VimFault().(type) {
+		case types.GuestOperationsUnavailable, types.ToolsUnavailable:
+			return fmt.Errorf("guest tools not running in %s: %s", c.ExecConfig.ID, err)
+		case types.GuestPermissionDenied:
+			return fmt.Errorf("guest auth rejected for %s: %s", c.ExecConfig.ID, err)
+		default:
+			// a tether without the no-op command fails the request once authenticated
+			return fmt.Errorf("self-test command not found in %s: %s", c.ExecConfig.ID, err)
+		}
+	}
+
+	return err
+}
+
+// StartFailedError is returned by run when the container never started
+type StartFailedError struct {
+	ID  string
+	err error
+}
+
+func (e StartFailedError) Error() string {
+	return fmt.Sprintf("%s failed to start: %s", e.ID, e.err)
+}
+
+// StartTimeoutError is returned by start when the VM powered on but the process launch was never
+// confirmed, with a diagnosis of where the launch stalled
+type StartTimeoutError struct {
+	ID        string
+	Diagnosis string
+	err       error
+}
+
+func (e StartTimeoutError) Error() string {
+	return fmt.Sprintf("unable to wait for process launch status of %s (%s): %s", e.ID, e.Diagnosis, e.err)
+}
+
+// diagnoses of a start timeout
+const (
+	tetherNotRunning  = "VM on, tether not running (guest tools not running)"
+	entrypointStalled = "VM on, tether running but entrypoint stalled"
+)
+
+// PowerStateTimeoutError is returned when a wait for a power state times out
+type PowerStateTimeoutError struct {
+	ID string
+
+	// Targets are the power states that were waited for
+	Targets []types.VirtualMachinePowerState
+
+	// Last is the last power state observed during the wait, empty if none was
+	Last types.VirtualMachinePowerState
+
+	Elapsed time.Duration
+}
+
+func (e PowerStateTimeoutError) Error() string {
+	return fmt.Sprintf("timeout (%s) waiting for %s to reach %v (last %q)", e.Elapsed, e.ID, e.Targets, e.Last)
+}
+
+// CrashLoopError is returned by start when the VM powers off within the stabilization window after the
+// process reported it had started, typically an entrypoint that exits immediately
+type CrashLoopError struct {
+	ID     string
+	Window time.Duration
+}
+
+func (e CrashLoopError) Error() string {
+	return fmt.Sprintf("%s powered off within %s of starting", e.ID, e.Window)
+}
+
+// DiskInfo describes a disk attached to a container VM
+type DiskInfo struct {
+	// Path is the datastore path of the disk backing file
+	Path string
+
+	// CapacityKB is the capacity of the disk in KB
+	CapacityKB int64
+}
+
+// AllocationSettings describes the configured allocation of a single resource
+type AllocationSettings struct {
+	// Reservation is the guaranteed amount of the resource
+	Reservation int64
+
+	// Limit is the upper bound on the amount of the resource, or -1 if unlimited
+	Limit int64
+
+	// Shares and SharesLevel determine the relative priority under contention
+	Shares      int32
+	SharesLevel types.SharesLevel
+}
+
+// ResourceAllocation describes the configured CPU (MHz) and memory (MB) allocation of a container VM
+type ResourceAllocation struct {
+	CPU    AllocationSettings
+	Memory AllocationSettings
+}
+
+// StartTimeoutPolicy governs what start does with a VM whose process launch was never confirmed
+type StartTimeoutPolicy int
+
+const (
+	// LeaveRunning leaves the VM powered on, e.g. for debugging
+	LeaveRunning StartTimeoutPolicy = iota
+
+	// PowerOff powers the VM off before the timeout is returned
+	PowerOff
+)
+
+// StartResult describes a successful start
+type StartResult struct {
+	// BootDuration is the time from power on completing to the Started key reporting true, or zero if
+	// start didn't wait for the Started key
+	BootDuration time.Duration
+}
+
+func (c *containerBase) start(ctx context.Context) (StartResult, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return StartResult{}, NotYetExistError{c.ExecConfig.ID}
+	}
+
+	if err := c.checkAccessible(ctx); err != nil {
+		return StartResult{}, err
+	}
+
+	c.waitForMigration(ctx)
+
+	// guestinfo key that we want to wait for
+	key, err := c.readyKey(c.ExecConfig.ID)
+	if err != nil {
+		return StartResult{}, err
+	}
+
+	// Power on
+	_, err = c.vm.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
+		return c.vm.PowerOn(ctx)
+	})
+	if err != nil {
+		return StartResult{}, err
+	}
+	poweredOn := time.Now()
+
+	if c.skipStartedWait {
+		return StartResult{}, nil
+	}
+
+	var detail string
+
+	// Wait some before giving up...
+	wctx, cancel := context.WithTimeout(ctx, PropertyCollectorTimeout())
+	defer cancel()
+
+	if cs, ok := c.ExecConfig.Sessions[c.ExecConfig.ID]; ok && cs.StartPollInterval > 0 {
+		detail, err = c.vm.PollForKeyInExtraConfig(wctx, key, cs.StartPollInterval)
+	} else {
+		detail, err = c.vm.WaitForKeyInExtraConfig(wctx, key)
+	}
+	if err != nil {
+		// if the caller abandoned the start don't leave the VM running unconfirmed
+		if ctx.Err() != nil {
+			return StartResult{}, c.abortStart(ctx.Err())
+		}
+
+		// diagnose before any power off destroys the evidence
+		err = c.diagnoseStartTimeout(ctx, err)
+
+		if c.startTimeoutPolicy == PowerOff {
+			c.logger().Warnf("powering off %s as process launch was not confirmed", c.ExecConfig.ID)
+			if perr := c.poweroff(ctx); perr != nil {
+				c.logger().Errorf("unable to power off %s after start timeout: %s", c.ExecConfig.ID, perr)
+			}
+		}
+
+		return StartResult{}, err
+	}
+
+	if detail != "true" {
+		return StartResult{}, errors.New(detail)
+	}
+
+	res := StartResult{BootDuration: time.Since(poweredOn)}
+
+	if cs, ok := c.ExecConfig.Sessions[c.ExecConfig.ID]; ok && cs.StartStabilize > 0 {
+		timeout, err := c.waitForPowerState(ctx, cs.StartStabilize, types.VirtualMachinePowerStatePoweredOff)
+		if err == nil {
+			return StartResult{}, CrashLoopError{ID: c.ExecConfig.ID, Window: cs.StartStabilize}
+		}
+
+		if !timeout {
+			return StartResult{}, fmt.Errorf("unable to confirm %s stayed running: %s", c.ExecConfig.ID, err)
+		}
+	}
+
+	return res, nil
+}
+
+// diagnoseStartTimeout wraps the error from waiting on the Started key in a StartTimeoutError, reporting
+// whether the tether is running. The guest tools of a container VM are served by the tether, so tools
+// running means the tether is.
+func (c *containerBase) diagnoseStartTimeout(ctx context.Context, err error) error {
+	running, terr := c.vm.IsToolsRunning(ctx)
+	if terr != nil {
+		return StartTimeoutError{ID: c.ExecConfig.ID, Diagnosis: fmt.Sprintf("VM on, unable to query guest tools: %s", terr), err: err}
+	}
+
+	if !running {
+		return StartTimeoutError{ID: c.ExecConfig.ID, Diagnosis: tetherNotRunning, err: err}
+	}
+
+	return StartTimeoutError{ID: c.ExecConfig.ID, Diagnosis: entrypointStalled, err: err}
+}
+
+// startAll starts the containers with no more than maxConcurrent starts in flight at once, and at
+// least stagger between successive power ons, to avoid overwhelming the host with boot IO. Each start
+// still waits for its Started key. The result of every start is returned keyed by container ID.
+func startAll(ctx context.Context, bases []*containerBase, maxConcurrent int, stagger time.Duration) map[string]error {
+	return forEachBounded(ctx, bases, maxConcurrent, stagger, func(c *containerBase) error {
+		_, err := c.start(ctx)
+		return err
+	})
+}
+
+// poweroffGroup hard powers off the containers, with no more than maxConcurrent power offs in flight at
+// once, e.g. for an emergency evacuation. No graceful shutdown is attempted, and containers that are
+// already powered off are treated as success. The result of every power off is returned keyed by
+// container ID.
+func poweroffGroup(ctx context.Context, bases []*containerBase, maxConcurrent int) map[string]error {
+	return forEachBounded(ctx, bases, maxConcurrent, 0, func(c *containerBase) error {
+		return c.poweroff(ctx)
+	})
+}
+
+// forEachBounded runs op on each of the containers with no more than maxConcurrent in flight at once, and
+// at least stagger between successive launches. Containers not yet launched when ctx is done are given
+// the context error. The results are returned keyed by container ID.
+func forEachBounded(ctx context.Context, bases []*containerBase, maxConcurrent int, stagger time.Duration, op func(c *containerBase) error) map[string]error {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]error, len(bases))
+	record := func(id string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[id] = err
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, maxConcurrent)
+	for i, base := range bases {
+		if i > 0 && stagger > 0 {
+			select {
+			case <-time.After(stagger):
+			case <-ctx.Done():
+			}
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		if err := ctx.Err(); err != nil {
+			record(base.ExecConfig.ID, err)
+			continue
+		}
+
+		wg.Add(1)
+		go func(c *containerBase) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			record(c.ExecConfig.ID, op(c))
+		}(base)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// startWithProgress is start with progress periodically invoked with the elapsed time and current power
+// state until start returns. A nil progress is plain start.
+func (c *containerBase) startWithProgress(ctx context.Context, progress func(elapsed time.Duration, state types.VirtualMachinePowerState)) (StartResult, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return StartResult{}, NotYetExistError{c.ExecConfig.ID}
+	}
+
+	if progress == nil {
+		return c.start(ctx)
+	}
+
+	began := time.Now()
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(startProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+
+			state, err := c.vm.PowerState(ctx)
+			if err != nil {
+				c.logger().Debugf("unable to get power state of %s for start progress: %s", c.ExecConfig.ID, err)
+				continue
+			}
+
+			progress(time.Since(began), state)
+		}
+	}()
+
+	res, err := c.start(ctx)
+
+	// progress must not be invoked once start has returned
+	close(done)
+	wg.Wait()
+
+	return res, err
+}
+
+// abortStart makes a best effort to power off a VM whose start was cancelled before the Started key
+// was confirmed. The caller's context is already done so the power off uses its own timeout.
+func (c *containerBase) abortStart(cause error) error {
+	c.logger().Warnf("start of %s aborted (%s), powering off", c.ExecConfig.ID, cause)
+
+	ctx, cancel := context.WithTimeout(context.Background(), abortStartTimeout)
+	defer cancel()
+
+	err := c.poweroff(ctx)
+	if err != nil {
+		c.logger().Errorf("unable to power off %s after aborted start: %s", c.ExecConfig.ID, err)
+	}
+
+	return StartAbortedError{
+		ID:         c.ExecConfig.ID,
+		Cause:      cause,
+		RolledBack: err == nil,
+	}
+}
+
+// wait blocks until the primary session exits and returns its exit status
+func (c *containerBase) wait(ctx context.Context) (int32, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return 0, NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if err := c.sessionExit(ctx, c.ExecConfig.ID); err != nil {
+		return 0, err
+	}
+
+	code, _, err := c.exitInfo(ctx)
+	return code, err
+}
+
+// tryExitCode returns the exit status of the primary session if it has exited, without waiting. exited is
+// false if the session is still running.
+func (c *containerBase) tryExitCode(ctx context.Context) (int32, bool, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return 0, false, NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if err := c.refresh(ctx); err != nil {
+		return 0, false, err
+	}
+
+	session, ok := c.ExecConfig.Sessions[c.ExecConfig.ID]
+	if !ok {
+		return 0, false, fmt.Errorf("no primary session found for %s", c.ExecConfig.ID)
+	}
+
+	if session.Started == "" {
+		return 0, false, fmt.Errorf("%s has not been started", c.ExecConfig.ID)
+	}
+
+	// the same conditions that end sessionExit
+	stopped := session.StopTime != 0 && session.StopTime >= session.StartTime
+	if !stopped && c.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOff {
+		return 0, false, nil
+	}
+
+	return int32(session.ExitStatus), true, nil
+}
+
+// waitForExit blocks until the primary session exits, returning nil only if it exited with expected
+func (c *containerBase) waitForExit(ctx context.Context, expected int32) error {
+	code, err := c.wait(ctx)
+	if err != nil {
+		return err
+	}
+
+	if code != expected {
+		return fmt.Errorf("%s exited with %d, expected %d", c.ExecConfig.ID, code, expected)
+	}
+
+	return nil
+}
+
+// run starts the container, waits for the primary session to exit and returns its exit status, for
+// one-shot job containers. The container is powered off if ctx is cancelled while it's running.
+func (c *containerBase) run(ctx context.Context) (int32, error) {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if _, err := c.start(ctx); err != nil {
+		if _, ok := err.(StartAbortedError); ok {
+			return 0, err
+		}
+		return 0, StartFailedError{ID: c.ExecConfig.ID, err: err}
+	}
+
+	code, err := c.wait(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			// the caller's context is done so a fresh one is needed to clean up
+			pctx, cancel := context.WithTimeout(context.Background(), abortStartTimeout)
+			defer cancel()
+
+			c.logger().Warnf("run of %s cancelled (%s), powering off", c.ExecConfig.ID, ctx.Err())
+			if perr := c.poweroff(pctx); perr != nil {
+				c.logger().Errorf("unable to power off %s after cancelled run: %s", c.ExecConfig.ID, perr)
+			}
+		}
+		return 0, err
+	}
+
+	return code, nil
+}
+
+// suspend suspends the container VM. A VM that's already suspended is not an error.
+func (c *containerBase) suspend(ctx context.Context) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	_, err := c.vm.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
+		return c.vm.Suspend(ctx)
+	})
+	if err != nil {
+		if terr, ok := err.(task.Error); ok {
+			if f, ok := terr.Fault().(*types.InvalidPowerState); ok && f.ExistingState == types.VirtualMachinePowerStateSuspended {
+				c.logger().Warnf("suspend %s task skipped (state was already %s)", c.ExecConfig.ID, f.ExistingState)
+				return nil
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// resume powers on a suspended container VM, restoring the guest from its suspended state rather than
+// booting it
+func (c *containerBase) resume(ctx context.Context) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	state, err := c.vm.PowerState(ctx)
+	if err != nil {
+		return err
+	}
+
+	if state != types.VirtualMachinePowerStateSuspended {
+		return fmt.Errorf("cannot resume %s as it is %s", c.ExecConfig.ID, state)
+	}
+
+	_, err = c.vm.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
+		return c.vm.PowerOn(ctx)
+	})
+	return err
+}
+
+// prewarm starts the container, letting it initialize, and then suspends it so that a later fastStart
+// is a resume rather than a boot
+func (c *containerBase) prewarm(ctx context.Context) error {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	res, err := c.start(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.logger().Infof("prewarmed %s in %s, suspending", c.ExecConfig.ID, res.BootDuration)
+	return c.suspend(ctx)
+}
+
+// fastStart resumes the container if it was prewarmed, otherwise it's started in full
+func (c *containerBase) fastStart(ctx context.Context) (StartResult, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return StartResult{}, NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	state, err := c.vm.PowerState(ctx)
+	if err != nil {
+		return StartResult{}, err
+	}
+
+	if state != types.VirtualMachinePowerStateSuspended {
+		return c.start(ctx)
+	}
+
+	began := time.Now()
+	if err := c.resume(ctx); err != nil {
+		return StartResult{}, err
+	}
+
+	return StartResult{BootDuration: time.Since(began)}, nil
+}
+
+// tryStart starts the container only if it's currently powered off, returning false without waiting
+// if the power state precludes starting
+func (c *containerBase) tryStart(ctx context.Context) (bool, error) {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if err := c.refresh(ctx); err != nil {
+		return false, err
+	}
+
+	if c.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOff {
+		c.logger().Debugf("not starting %s as power state is %s", c.ExecConfig.ID, c.Runtime.PowerState)
+		return false, nil
+	}
+
+	_, err := c.start(ctx)
+	return true, err
+}
+
+func (c *containerBase) stop(ctx context.Context, waitTime *int32) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	if err := c.checkAccessible(ctx); err != nil {
+		return err
+	}
+
+	c.waitForMigration(ctx)
+
+	// get existing state and set to stopping
+	// if there's a failure we'll revert to existing
+
+	// every operation issued from here on is counted so a flapping VM can't cause unbounded retries
+	if _, ok := ctx.Value(stopBudgetKey{}).(*stopBudget); !ok {
+		ctx = context.WithValue(ctx, stopBudgetKey{}, newStopBudget(c.ExecConfig.ID, len(c.ExecConfig.Sessions), waitTime))
+	}
+
+	// if the caller has a deadline it bounds the entire escalation - the graceful phase
+	// is truncated so that the hard power off still has time to complete
+	gctx := ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		graceful := deadline.Add(-powerOffReserve)
+		if !time.Now().Before(graceful) {
+			c.logger().Warnf("stopping %s via hard power off as deadline %s leaves no time for graceful shutdown", c.ExecConfig.ID, deadline)
+
+			pctx, cancel := powerOffContext(ctx)
+			defer cancel()
+			return c.poweroff(pctx)
+		}
+
+		var cancel context.CancelFunc
+		gctx, cancel = context.WithDeadline(ctx, graceful)
+		defer cancel()
+	}
+
+	var err error
+	if cs, ok := c.ExecConfig.Sessions[c.ExecConfig.ID]; ok && cs.ShutdownGuest {
+		err = c.shutdownViaTools(gctx, waitTime)
+	} else {
+		var sig string
+		sig, err = c.shutdown(gctx, waitTime)
+		if err == nil && sig != "" {
+			c.logger().Infof("%s stopped via SIG%s", c.ExecConfig.ID, sig)
+		}
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := err.(StopExhaustedError); ok {
+		c.logger().Errorf("stopping %s via hard power off as %s", c.ExecConfig.ID, err)
+	} else {
+		c.logger().Warnf("stopping %s via hard power off due to: %s", c.ExecConfig.ID, err)
+	}
+
+	if version, status, verr := c.toolsVersion(ctx); verr == nil {
+		c.logger().Infof("%s guest tools version %s (%s)", c.ExecConfig.ID, version, status)
+	}
+
+	pctx, cancel := powerOffContext(ctx)
+	defer cancel()
+	return c.poweroff(pctx)
+}
+
+// canShutdownGracefully reports whether stop can be expected to shut the container down gracefully
+// rather than resorting to a hard power off, with the reason if it cannot
+func (c *containerBase) canShutdownGracefully(ctx context.Context) (bool, string, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return false, "", NotYetExistError{c.ExecConfig.ID}
+	}
+
+	cs, ok := c.ExecConfig.Sessions[c.ExecConfig.ID]
+	if !ok {
+		return false, "no primary session", nil
+	}
+
+	// shutdown sends SIGTERM if no stop signal is configured, so only a signal the guest can't be sent
+	// rules out a graceful stop
+	if !cs.ShutdownGuest && cs.ShutdownScript == "" && cs.StopSignal != "" {
+		if _, err := normalizeSignal(cs.StopSignal); err != nil {
+			return false, fmt.Sprintf("invalid stop signal: %s", err), nil
+		}
+	}
+
+	running, err := c.vm.IsToolsRunning(ctx)
+	if err != nil {
+		return false, "", err
+	}
+
+	if !running {
+		return false, "no guest tools", nil
+	}
+
+	return true, "", nil
+}
+
+func (c *containerBase) kill(ctx context.Context) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	attempts := 1 // default
+	if cs, ok := c.ExecConfig.Sessions[c.ExecConfig.ID]; ok && cs.KillAttempts > 1 {
+		attempts = cs.KillAttempts
+	}
+
+	// the overall wait is shared between the attempts
+	wait := 10 * time.Second / time.Duration(attempts)
+	sig := string(ssh.SIGKILL)
+
+	for i := 1; i <= attempts && ctx.Err() == nil; i++ {
+		// leave time for the hard power off within the caller's deadline
+		w := deadlineWait(ctx, wait, powerOffReserve)
+		if w < minGraceWait {
+			c.logger().Warnf("deadline leaves no time to kill %s in the guest", c.ExecConfig.ID)
+			break
+		}
+
+		c.logger().Infof("sending kill -%s %s (attempt %d of %d)", sig, c.ExecConfig.ID, i, attempts)
+
+		err := c.startGuestProgram(ctx, "kill", c.guestSignal(sig))
+		if err == nil {
+			c.logger().Infof("waiting %s for %s to power off", w, c.ExecConfig.ID)
+			timeout, err := c.waitForPowerState(ctx, w, types.VirtualMachinePowerStatePoweredOff)
+			if err == nil {
+				return nil // VM has powered off
+			}
+
+			if timeout {
+				c.logger().Warnf("timeout (%s) waiting for %s to power off via SIG%s", w, c.ExecConfig.ID, sig)
+				continue
+			}
+		}
+
+		if err != nil {
+			if _, ok := err.(GuestAuthError); ok {
+				c.logger().Warnf("guest auth rejected sending kill -%s %s", sig, c.ExecConfig.ID)
+			}
+			c.logger().Warnf("killing %s attempt resulted in: %s", c.ExecConfig.ID, err)
+		}
+	}
+
+	c.logger().Warnf("killing %s via hard power off", c.ExecConfig.ID)
+
+	return c.poweroff(ctx)
+}
+
+// shutdown stops the primary session and returns the signal that resulted in power off. The escalation
+// has three tiers: first the session's shutdown script if one is configured, then the session's stop
+// signal followed by SIGKILL, and finally a hard power off, which is left to the caller - hardPowerOff is
+// returned with the error in that case. The script path is returned if the script was sufficient, and an
+// empty signal if the sessions were signalled individually.
+func (c *containerBase) shutdown(ctx context.Context, waitTime *int32) (string, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return hardPowerOff, NotYetExistError{c.ExecConfig.ID}
+	}
+
+	cs, ok := c.ExecConfig.Sessions[c.ExecConfig.ID]
+	if !ok || cs == nil {
+		return hardPowerOff, fmt.Errorf("no primary session found for %s", c.ExecConfig.ID)
+	}
+
+	if cs.SignalAll {
+		if err := c.shutdownSessions(ctx, waitTime); err != nil {
+			return hardPowerOff, err
+		}
+		return "", nil
+	}
+
+	wait := shutdownWait(waitTime)
+
+	if cs.ShutdownScript != "" {
+		err := c.runShutdownScript(ctx, cs.ShutdownScript, deadlineWait(ctx, wait, 0))
+		if err == nil {
+			return cs.ShutdownScript, nil
+		}
+
+		if _, ok := err.(StopExhaustedError); ok {
+			return hardPowerOff, err
+		}
+
+		c.logger().Warnf("shutdown script did not stop %s, falling back to signals: %s", c.ExecConfig.ID, err)
+	}
+
+	stop := []string{cs.StopSignal, string(ssh.SIGKILL)}
+	if stop[0] == "" {
+		stop[0] = string(ssh.SIGTERM)
+	}
+	args := []string{c.stopSignalArg(stop[0]), c.stopSignalArg(stop[1])}
+	targets := []string{c.ExecConfig.ID, c.ExecConfig.ID}
+
+	// stragglers left by an image without a reaping init are sent the stop signal and then SIGKILL too
+	if cs.SignalBroadcast {
+		stop = []string{stop[0], stop[0], string(ssh.SIGKILL)}
+		args = []string{args[0], c.broadcastSignalArg(stop[0]), c.broadcastSignalArg(stop[2])}
+		targets = []string{c.ExecConfig.ID, "all processes of " + c.ExecConfig.ID, "all processes of " + c.ExecConfig.ID}
+	}
+
+	for i, sig := range stop {
+		// don't start another signal if the deadline has already passed, or is too close to wait for it
+		if err := ctx.Err(); err != nil {
+			return hardPowerOff, fmt.Errorf("failed to shutdown %s before deadline: %s", c.ExecConfig.ID, err)
+		}
+
+		wait := deadlineWait(ctx, wait, 0)
+		if wait < minGraceWait {
+			return hardPowerOff, fmt.Errorf("deadline leaves too little time (%s) to shutdown %s via SIG%s", wait, c.ExecConfig.ID, sig)
+		}
+
+		msg := fmt.Sprintf("sending kill -%s %s", sig, targets[i])
+		if err := spendStopBudget(ctx, msg); err != nil {
+			return hardPowerOff, err
+		}
+		c.logger().Info(msg)
+
+		err := c.startGuestProgram(ctx, "kill", args[i])
+		if err != nil {
+			switch err.(type) {
+			case GuestAuthError:
+				c.logger().Warnf("guest auth rejected sending kill -%s %s", sig, c.ExecConfig.ID)
+			case GuestProgramNotFoundError:
+				c.logger().Warnf("kill binary not found in %s, falling back to hard power off", c.ExecConfig.ID)
+			}
+			return hardPowerOff, fmt.Errorf("%s: %s", msg, err)
+		}
+
+		// the cleanup runs within the grace window of the stop signal
+		remaining := wait
+		if i == 0 && cs.CleanupCmd != "" {
+			c.runCleanup(ctx)
+		}
+
+		var timeout bool
+		if cs.StopAck {
+			c.logger().Infof("waiting %s for %s to acknowledge stop or power off", remaining, c.ExecConfig.ID)
+			timeout, err = c.waitForStopAck(ctx, remaining)
+		} else {
+			c.logger().Infof("waiting %s for %s to power off", remaining, c.ExecConfig.ID)
+			timeout, err = c.waitForPowerState(ctx, remaining, types.VirtualMachinePowerStatePoweredOff)
+		}
+		if err == nil {
+			return sig, nil // VM has powered off
+		}
+
+		if !timeout {
+			return hardPowerOff, err // error other than timeout
+		}
+
+		c.logger().Warnf("timeout (%s) waiting for %s to power off via SIG%s", wait, c.ExecConfig.ID, sig)
+	}
+
+	return hardPowerOff, fmt.Errorf("failed to shutdown %s via kill signals %s", c.ExecConfig.ID, stop)
+}
+
+// runShutdownScript has the tether start the shutdown script of the primary session and waits up to wait
+// for the VM to power off
+func (c *containerBase) runShutdownScript(ctx context.Context, script string, wait time.Duration) error {
+	msg := fmt.Sprintf("running shutdown script %s in %s", script, c.ExecConfig.ID)
+	if err := spendStopBudget(ctx, msg); err != nil {
+		return err
+	}
+	c.logger().Info(msg)
+
+	if err := c.startGuestProgram(ctx, "shutdown-script", ""); err != nil {
+		return fmt.Errorf("%s: %s", msg, err)
+	}
+
+	c.logger().Infof("waiting %s for %s to power off", wait, c.ExecConfig.ID)
+	timeout, err := c.waitForPowerState(ctx, wait, types.VirtualMachinePowerStatePoweredOff)
+	if err == nil {
+		return nil // VM has powered off
+	}
+
+	if timeout {
+		return fmt.Errorf("timeout (%s) waiting for %s to power off via shutdown script", wait, c.ExecConfig.ID)
+	}
+
+	return err
+}
+
+// runCleanup has the tether start the cleanup command of the primary session, which then runs within the
+// grace window of the stop signal. Failures are logged rather than returned as the container is stopping
+// regardless.
+func (c *containerBase) runCleanup(ctx context.Context) {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	c.logger().Infof("running cleanup command in %s", c.ExecConfig.ID)
+	if err := c.startGuestProgram(ctx, "cleanup", ""); err != nil {
+		c.logger().Warnf("unable to run cleanup command in %s: %s", c.ExecConfig.ID, err)
+	}
+}
+
+// shutdownSessions signals every session concurrently, escalating each from its stop signal to SIGKILL
+// independently, and then waits for the VM to power off. Signalling errors are collected rather than
+// ending the shutdown early.
+func (c *containerBase) shutdownSessions(ctx context.Context, waitTime *int32) error {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	wait := shutdownWait(waitTime)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(c.ExecConfig.Sessions))
+	for id, cs := range c.ExecConfig.Sessions {
+		wg.Add(1)
+		go func(id string, sig string) {
+			defer wg.Done()
+
+			if err := c.signalSession(ctx, id, sig, wait); err != nil {
+				errs <- err
+			}
+		}(id, cs.StopSignal)
+	}
+	wg.Wait()
+	close(errs)
+
+	var failures []string
+	for err := range errs {
+		if _, ok := err.(StopExhaustedError); ok {
+			return err
+		}
+
+		c.logger().Warn(err)
+		failures = append(failures, err.Error())
+	}
+
+	c.logger().Infof("waiting %s for %s to power off", wait, c.ExecConfig.ID)
+	timeout, err := c.waitForPowerState(ctx, wait, types.VirtualMachinePowerStatePoweredOff)
+	if err == nil {
+		return nil // VM has powered off
+	}
+
+	if !timeout {
+		return err // error other than timeout
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("timeout (%s) waiting for %s to power off after signalling sessions: %s", wait, c.ExecConfig.ID, strings.Join(failures, "; "))
+	}
+
+	return fmt.Errorf("timeout (%s) waiting for %s to power off after signalling sessions", wait, c.ExecConfig.ID)
+}
+
+// stopSession stops a single secondary session, e.g. an exec session, leaving the container VM and its
+// other sessions running. The primary session can only be stopped by stopping the container. Stopping a
+// session that has already exited is a no-op.
+func (c *containerBase) stopSession(ctx context.Context, sessionID string, waitTime *int32) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(sessionID))
+
+	if sessionID == c.ExecConfig.ID {
+		return fmt.Errorf("session %s is the primary session of %s, stop the container instead", sessionID, c.ExecConfig.ID)
+	}
+
+	if err := c.refresh(ctx); err != nil {
+		return err
+	}
+
+	cs, ok := c.ExecConfig.Sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("no session %s found in %s", sessionID, c.ExecConfig.ID)
+	}
+
+	// the tether can only signal a session it has launched
+	if cs.Started == "" {
+		return fmt.Errorf("session %s of %s has not been started", sessionID, c.ExecConfig.ID)
+	}
+
+	if cs.StopTime != 0 && cs.StopTime >= cs.StartTime {
+		c.logger().Infof("session %s of %s has already exited", sessionID, c.ExecConfig.ID)
+		return nil
+	}
+
+	if _, ok := ctx.Value(stopBudgetKey{}).(*stopBudget); !ok {
+		ctx = context.WithValue(ctx, stopBudgetKey{}, newStopBudget(c.ExecConfig.ID, 1, waitTime))
+	}
+
+	return c.signalSession(ctx, sessionID, cs.StopSignal, shutdownWait(waitTime))
+}
+
+// signalSession signals a single session with its stop signal, escalating to SIGKILL if the session hasn't
+// exited within wait. The session is named as a session:<id> kill target so the tether signals it rather
+// than the primary session, and rejects an ID it doesn't know.
+func (c *containerBase) signalSession(ctx context.Context, id string, stopSignal string, wait time.Duration) error {
+	stop := []string{stopSignal, string(ssh.SIGKILL)}
+	if stop[0] == "" {
+		stop[0] = string(ssh.SIGTERM)
+	}
+
+	for _, sig := range stop {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("failed to stop session %s of %s before deadline: %s", id, c.ExecConfig.ID, err)
+		}
+
+		msg := fmt.Sprintf("sending kill -%s to session %s of %s", sig, id, c.ExecConfig.ID)
+		if err := spendStopBudget(ctx, msg); err != nil {
+			return err
+		}
+		c.logger().Info(msg)
+
+		if _, err := c.launchSessionProgram(ctx, id, "kill", fmt.Sprintf("%s session:%s", c.guestSignal(sig), id)); err != nil {
+			return fmt.Errorf("%s: %s", msg, err)
+		}
+
+		timeout, err := c.waitForSessionExit(ctx, id, wait)
+		if err == nil {
+			return nil
+		}
+
+		if !timeout {
+			return err
+		}
+
+		c.logger().Warnf("timeout (%s) waiting for session %s of %s to exit via SIG%s", wait, id, c.ExecConfig.ID, sig)
+	}
+
+	return fmt.Errorf("failed to stop session %s of %s via kill signals %s", id, c.ExecConfig.ID, stop)
+}
+
+// waitForSessionExit waits up to max for the session to publish a stop time later than its start time,
+// or for the VM to power off
+func (c *containerBase) waitForSessionExit(ctx context.Context, id string, max time.Duration) (bool, error) {
+	wctx, cancel := context.WithTimeout(ctx, max)
+	defer cancel()
+
+	if err := c.sessionExit(wctx, id); err != nil {
+		return wctx.Err() != nil, err
+	}
+
+	return false, nil
+}
+
+// sessionExit blocks until the session publishes a stop time later than its start time, or the VM
+// powers off
+func (c *containerBase) sessionExit(ctx context.Context, id string) error {
+	startKey := extraconfig.CalculateKeys(c.ExecConfig, fmt.Sprintf("Sessions.%s.StartTime", id), "")[0]
+	stopKey := extraconfig.CalculateKeys(c.ExecConfig, fmt.Sprintf("Sessions.%s.StopTime", id), "")[0]
+
+	var start, stop int64
+	return c.vm.WaitForExtraConfig(ctx, func(pc []types.PropertyChange) bool {
+		for _, change := range pc {
+			if change.Op != types.PropertyChangeOpAssign {
+				continue
+			}
+
+			switch v := change.Val.(type) {
+			case types.ArrayOfOptionValue:
+				for _, value := range v.OptionValue {
+					ov := value.GetOptionValue()
+					detail, _ := ov.Value.(string)
+
+					switch ov.Key {
+					case startKey:
+						start, _ = strconv.ParseInt(detail, 10, 64)
+					case stopKey:
+						stop, _ = strconv.ParseInt(detail, 10, 64)
+					}
+				}
+			case types.VirtualMachinePowerState:
+				if v == types.VirtualMachinePowerStatePoweredOff {
+					return true
+				}
+			}
+		}
+		return stop != 0 && stop >= start
+	})
+}
+
+// waitForStopAck waits up to max for either the primary session to acknowledge a clean stop via its
+// Stopped key, or the VM to power off, and logs which occurred. Once acknowledged the remainder of the
+// wait is allowed for the power off.
+func (c *containerBase) waitForStopAck(ctx context.Context, max time.Duration) (bool, error) {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	key := extraconfig.CalculateKeys(c.ExecConfig, fmt.Sprintf("Sessions.%s.Stopped", c.ExecConfig.ID), "")[0]
+
+	deadline := time.Now().Add(max)
+	timeout, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	var acked, poweredOff bool
+	err := c.vm.WaitForExtraConfig(timeout, func(pc []types.PropertyChange) bool {
+		for _, change := range pc {
+			if change.Op != types.PropertyChangeOpAssign {
+				continue
+			}
+
+			switch v := change.Val.(type) {
+			case types.ArrayOfOptionValue:
+				for _, value := range v.OptionValue {
+					ov := value.GetOptionValue()
+					if ov.Key != key {
+						continue
+					}
+
+					if detail, _ := ov.Value.(string); detail != "" && detail != "<nil>" {
+						acked = true
+					}
+				}
+			case types.VirtualMachinePowerState:
+				poweredOff = v == types.VirtualMachinePowerStatePoweredOff
+			}
+		}
+		return acked || poweredOff
+	})
+	if err != nil {
+		return timeout.Err() != nil, err
+	}
+
+	if !acked {
+		c.logger().Infof("%s powered off without stop acknowledgement", c.ExecConfig.ID)
+		return false, nil
+	}
+
+	c.logger().Infof("%s acknowledged clean stop", c.ExecConfig.ID)
+	if poweredOff {
+		return false, nil
+	}
+
+	return c.waitForPowerState(ctx, time.Until(deadline), types.VirtualMachinePowerStatePoweredOff)
+}
+
+// attachDisk adds the disk described by spec to the container VM, which may be running
+func (c *containerBase) attachDisk(ctx context.Context, spec types.VirtualDeviceConfigSpec) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if spec.Operation != types.VirtualDeviceConfigSpecOperationAdd {
+		return fmt.Errorf("disk attach to %s requires an add operation, not %q", c.ExecConfig.ID, spec.Operation)
+	}
+
+	if _, ok := spec.Device.(*types.VirtualDisk); !ok {
+		return fmt.Errorf("disk attach to %s requires a virtual disk device, not %T", c.ExecConfig.ID, spec.Device)
+	}
+
+	config := types.VirtualMachineConfigSpec{
+		DeviceChange: []types.BaseVirtualDeviceConfigSpec{&spec},
+	}
+
+	_, err := c.vm.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
+		return c.vm.Reconfigure(ctx, config)
+	})
+	if err != nil {
+		if terr, ok := err.(task.Error); ok {
+			switch terr.Fault().(type) {
+			case *types.DeviceHotPlugNotSupported:
+				return HotAddNotSupportedError{ID: c.ExecConfig.ID, err: err}
+			}
+		}
+
+		return err
+	}
+
+	return c.refresh(ctx)
+}
+
+// host returns the host the container VM is running on, refreshing Runtime first if it hasn't been fetched
+func (c *containerBase) host(ctx context.Context) (types.ManagedObjectReference, error) {
+	if c.Runtime == nil {
+		if err := c.refresh(ctx); err != nil {
+			return types.ManagedObjectReference{}, err
+		}
+	}
+
+	if c.Runtime.Host == nil {
+		return types.ManagedObjectReference{}, fmt.Errorf("%s is not placed on a host", c.ExecConfig.ID)
+	}
+
+	return *c.Runtime.Host, nil
+}
+
+// setDRSOverride sets the DRS automation level of the container VM in its cluster, overriding the cluster
+// default, e.g. to pin the VM to its current host with DrsBehaviorManual. An error is returned if the VM
+// isn't in a DRS enabled cluster.
+func (c *containerBase) setDRSOverride(ctx context.Context, behavior types.DrsBehavior) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	host, err := c.host(ctx)
+	if err != nil {
+		return err
+	}
+
+	p := property.DefaultCollector(c.vm.Vim25())
+
+	var h mo.HostSystem
+	if err := p.RetrieveOne(ctx, host, []string{"parent"}, &h); err != nil {
+		return err
+	}
+
+	if h.Parent == nil || h.Parent.Type != "ClusterComputeResource" {
+		return fmt.Errorf("%s is not in a cluster, DRS override not possible", c.ExecConfig.ID)
+	}
+
+	var cluster mo.ClusterComputeResource
+	if err := p.RetrieveOne(ctx, *h.Parent, []string{"configurationEx"}, &cluster); err != nil {
+		return err
+	}
+
+	info, ok := cluster.ConfigurationEx.(*types.ClusterConfigInfoEx)
+	if !ok || info.DrsConfig.Enabled == nil || !*info.DrsConfig.Enabled {
+		return fmt.Errorf("DRS is not enabled in cluster %s of %s", h.Parent.Value, c.ExecConfig.ID)
+	}
+
+	// edit an existing override rather than adding a second
+	op := types.ArrayUpdateOperationAdd
+	for _, override := range info.DrsVmConfig {
+		if override.Key == c.vm.Reference() {
+			op = types.ArrayUpdateOperationEdit
+			break
+		}
+	}
+
+	enabled := true
+	spec := &types.ClusterConfigSpecEx{
+		DrsVmConfigSpec: []types.ClusterDrsVmConfigSpec{
+			{
+				ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: op},
+				Info: &types.ClusterDrsVmConfigInfo{
+					Key:      c.vm.Reference(),
+					Enabled:  &enabled,
+					Behavior: behavior,
+				},
+			},
+		},
+	}
+
+	c.logger().Infof("setting DRS behavior of %s to %s", c.ExecConfig.ID, behavior)
+	cr := object.NewClusterComputeResource(c.vm.Vim25(), *h.Parent)
+	_, err = c.vm.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
+		return cr.Reconfigure(ctx, spec, true)
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.refresh(ctx)
+}
+
+// assertHost refreshes Runtime and returns an error if the container VM isn't on the expected host, e.g.
+// to detect DRS moving it away from a peer it was placed alongside
+func (c *containerBase) assertHost(ctx context.Context, expected types.ManagedObjectReference) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	if err := c.refresh(ctx); err != nil {
+		return err
+	}
+
+	actual, err := c.host(ctx)
+	if err != nil {
+		return err
+	}
+
+	if actual != expected {
+		return fmt.Errorf("%s is on host %s rather than %s", c.ExecConfig.ID, actual, expected)
+	}
+
+	return nil
+}
+
+// exists checks whether the container VM still exists in the inventory with a minimal property fetch,
+// without the cost of a full refresh
+func (c *containerBase) exists(ctx context.Context) (bool, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return false, nil
+	}
+
+	// an empty property set would fetch everything, so ask for the name alone
+	var o mo.VirtualMachine
+	if err := c.vm.Properties(ctx, c.vm.Reference(), []string{"name"}, &o); err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// waitForGone polls until the VM is no longer in inventory, e.g. to confirm a destroy has been fully
+// processed, or max elapses
+func (c *containerBase) waitForGone(ctx context.Context, max time.Duration) error {
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	wctx, cancel := context.WithTimeout(ctx, max)
+	defer cancel()
+
+	ticker := time.NewTicker(gonePollInterval)
+	defer ticker.Stop()
+
+	for {
+		present, err := c.exists(wctx)
+		if err != nil {
+			return err
+		}
+
+		if !present {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-wctx.Done():
+			if ctx.Err() == nil {
+				return fmt.Errorf("timeout (%s) waiting for %s to be removed: VM still present as %s", max, c.ExecConfig.ID, c.vm.Reference())
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// isNotFound returns true if the error indicates that the managed object no longer exists
+func isNotFound(err error) bool {
+	if soap.IsSoapFault(err) {
+		if _, ok := soap.ToSoapFault(err).VimFault().(types.ManagedObjectNotFound); ok {
+			return true
+		}
+	}
+
+	if f, ok := err.(types.HasFault); ok {
+		if _, ok := f.Fault().(*types.ManagedObjectNotFound); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// terminate tears down a container known to be bad, e.g. after a CrashLoopError or StartFailedError,
+// without attempting a graceful shutdown. A best-effort SIGKILL is sent without waiting before the VM is
+// powered off and destroyed. Each phase tolerates having already been done.
+func (c *containerBase) terminate(ctx context.Context) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	state, err := c.vm.PowerState(ctx)
+	if err != nil {
+		if isNotFound(err) {
+			c.logger().Infof("%s already destroyed", c.ExecConfig.ID)
+			return nil
+		}
+		return err
+	}
+
+	if state == types.VirtualMachinePowerStatePoweredOn {
+		if err := c.startGuestProgram(ctx, "kill", c.guestSignal(string(ssh.SIGKILL))); err != nil {
+			c.logger().Debugf("best effort kill of %s failed: %s", c.ExecConfig.ID, err)
+		}
+	}
+
+	return c.destroy(ctx)
+}
+
+// destroy powers off the container VM if needed and then deletes it. A VM that's already gone is not
+// treated as an error, so destroy can be safely repeated.
+func (c *containerBase) destroy(ctx context.Context) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	// poweroff tolerates a VM that's already off
+	if err := c.poweroff(ctx); err != nil {
+		if isNotFound(err) {
+			c.logger().Infof("%s already destroyed", c.ExecConfig.ID)
+			return nil
+		}
+		return err
+	}
+
+	destroy := func(ctx context.Context) (tasks.Task, error) {
+		return c.vm.Destroy(ctx)
+	}
+
+	c.logger().Infof("destroying %s", c.ExecConfig.ID)
+	_, err := c.vm.WaitForResult(ctx, destroy)
+
+	// a concurrent start may have powered the VM back on after the power off
+	if terr, ok := err.(task.Error); ok {
+		if _, ok := terr.Fault().(*types.InvalidPowerState); ok {
+			c.logger().Warnf("%s powered on during destroy, powering off and retrying", c.ExecConfig.ID)
+
+			if err = c.poweroff(ctx); err == nil {
+				_, err = c.vm.WaitForResult(ctx, destroy)
+			}
+		}
+	}
+
+	if err != nil && isNotFound(err) {
+		c.logger().Infof("%s already destroyed", c.ExecConfig.ID)
+		return nil
+	}
+
+	return err
+}
+
+// consoleLog returns up to the last maxBytes of the guest console log, which is written to the datastore
+// via a file backed serial port. This doesn't depend on guest tools so is available for guests that
+// failed to boot.
+func (c *containerBase) consoleLog(ctx context.Context, maxBytes int64) ([]byte, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return nil, NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if c.Config == nil {
+		if err := c.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var name string
+	for _, device := range c.Config.Hardware.Device {
+		serial, ok := device.(*types.VirtualSerialPort)
+		if !ok {
+			continue
+		}
+
+		backing, ok := serial.Backing.(*types.VirtualSerialPortFileBackingInfo)
+		if !ok {
+			continue
+		}
+
+		// prefer the debug log which carries the console output
+		if name == "" || strings.HasSuffix(backing.FileName, consoleLogName) {
+			name = backing.FileName
+		}
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("no file backed serial port found for %s", c.ExecConfig.ID)
+	}
+
+	// strip the datastore from the datastore path
+	if ix := strings.Index(name, "] "); ix != -1 {
+		name = name[ix+2:]
+	}
+
+	if c.Runtime != nil && c.Runtime.PowerState == types.VirtualMachinePowerStatePoweredOn && c.vm.IsVC() {
+		// the running VM's host owns the file lock
+		if h, _ := c.vm.HostSystem(ctx); h != nil {
+			ctx = c.vm.Datastore.HostContext(ctx, h)
+		}
+	}
+
+	c.logger().Debugf("pulling console log %s for %s", name, c.ExecConfig.ID)
+	file, err := c.vm.Datastore.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if maxBytes > 0 {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Size() > maxBytes {
+			if _, err = file.Seek(-maxBytes, io.SeekEnd); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return ioutil.ReadAll(file)
+}
+
+// rebootGuest restarts the guest OS in place via tools and waits for the primary session to report it's
+// started again. Falls back to a hard reset if the tools reboot fails or doesn't complete in time.
+func (c *containerBase) rebootGuest(ctx context.Context) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	c.logger().Infof("requesting guest reboot of %s", c.ExecConfig.ID)
+	err := c.vm.RebootGuest(ctx)
+	if err == nil {
+		wctx, cancel := context.WithTimeout(ctx, PropertyCollectorTimeout())
+		defer cancel()
+
+		if err = c.waitForRestart(wctx); err == nil {
+			return nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	c.logger().Warnf("resetting %s via hard reset due to: %s", c.ExecConfig.ID, err)
+
+	_, err = c.vm.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
+		return c.vm.Reset(ctx)
+	})
+	return err
+}
+
+// waitForRestart waits for the Started key of the primary session to leave "true" as the guest shuts
+// down, and then return to "true" once it has booted again
+func (c *containerBase) waitForRestart(ctx context.Context) error {
+	key := c.startedKey(c.ExecConfig.ID)
+
+	var stopped bool
+	var poweredOff error
+	err := c.vm.WaitForExtraConfig(ctx, func(pc []types.PropertyChange) bool {
+		for _, change := range pc {
+			if change.Op != types.PropertyChangeOpAssign {
+				continue
+			}
+
+			switch v := change.Val.(type) {
+			case types.ArrayOfOptionValue:
+				for _, value := range v.OptionValue {
+					ov := value.GetOptionValue()
+					if ov.Key != key {
+						continue
+					}
+
+					detail, _ := ov.Value.(string)
+					if detail != "true" {
+						stopped = true
+					} else if stopped {
+						return true
+					}
+				}
+			case types.VirtualMachinePowerState:
+				if v != types.VirtualMachinePowerStatePoweredOn {
+					poweredOff = fmt.Errorf("%s powered off during reboot", c.ExecConfig.ID)
+					return true
+				}
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+
+	return poweredOff
+}
+
+// freeze suspends scheduling of the container processes via the freezer cgroup of the primary session,
+// leaving the VM running. The tether writes the freezer state.
+func (c *containerBase) freeze(ctx context.Context) error {
+	return c.setFreezerState(ctx, "freeze")
+}
+
+// unfreeze resumes the container processes suspended by freeze
+func (c *containerBase) unfreeze(ctx context.Context) error {
+	return c.setFreezerState(ctx, "thaw")
+}
+
+// setFreezerState has the tether update the freezer cgroup of the primary session via the given command
+func (c *containerBase) setFreezerState(ctx context.Context, cmd string) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	c.logger().Infof("requesting %s of %s", cmd, c.ExecConfig.ID)
+	if err := c.startGuestProgram(ctx, cmd, ""); err != nil {
+		return fmt.Errorf("unable to %s %s: %s", cmd, c.ExecConfig.ID, err)
+	}
+
+	return nil
+}
+
+// deadlineWait clamps wait to the time remaining before the ctx deadline, less reserve
+func deadlineWait(ctx context.Context, wait time.Duration, reserve time.Duration) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return wait
+	}
+
+	if remaining := time.Until(deadline) - reserve; remaining < wait {
+		return remaining
+	}
+	return wait
+}
+
+// detachedContext carries the values of its parent, such as the stop budget, but not its deadline or
+// cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+func (d detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (d detachedContext) Done() <-chan struct{} { return nil }
+
+func (d detachedContext) Err() error { return nil }
+
+func (d detachedContext) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// powerOffContext returns the context for the hard power off that ends a stop. The caller's deadline may
+// already have passed by then, so the power off is detached from it and bounded by powerOffReserve, the
+// time held back from the deadline for it, instead.
+func powerOffContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); !ok {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(detachedContext{ctx}, powerOffReserve)
+}
+
+// shutdownWait returns how long to wait for each shutdown step, defaulting to 10s
+func shutdownWait(waitTime *int32) time.Duration {
+	if waitTime != nil && *waitTime > 0 {
+		return time.Duration(*waitTime) * time.Second
+	}
+
+	return 10 * time.Second
+}
+
+// shutdownViaTools issues a guest OS shutdown and waits for the VM to power off, for images whose init
+// system expects that rather than a signal. stop falls back to a hard power off on failure.
+func (c *containerBase) shutdownViaTools(ctx context.Context, waitTime *int32) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	wait := shutdownWait(waitTime)
+
+	if err := spendStopBudget(ctx, "guest shutdown"); err != nil {
+		return err
+	}
+
+	c.logger().Infof("requesting guest shutdown of %s", c.ExecConfig.ID)
+	if err := c.vm.ShutdownGuest(ctx); err != nil {
+		return fmt.Errorf("requesting guest shutdown of %s: %s", c.ExecConfig.ID, err)
+	}
+
+	c.logger().Infof("waiting %s for %s to power off", wait, c.ExecConfig.ID)
+	timeout, err := c.waitForPowerState(ctx, wait, types.VirtualMachinePowerStatePoweredOff)
+	if err == nil {
+		return nil // VM has powered off
+	}
+
+	if timeout {
+		return fmt.Errorf("timeout (%s) waiting for %s to power off via guest shutdown", wait, c.ExecConfig.ID)
+	}
+
+	return err
+}
+
+func (c *containerBase) poweroff(ctx context.Context) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	// the power off is the last resort of a stop, so is never refused by the budget
+	recordStopOperation(ctx, "power off")
+
+	powerOff := func(ctx context.Context) (tasks.Task, error) {
+		return c.vm.PowerOff(ctx)
+	}
+
+	_, err := c.vm.WaitForResult(ctx, powerOff)
+	if err != nil {
+		// a suspend in flight blocks the power off, so let it finish and power off from the result
+		suspending, serr := c.waitForSuspend(ctx)
+		if serr != nil {
+			c.logger().Warnf("unable to check for in-flight suspend of %s: %s", c.ExecConfig.ID, serr)
+		}
+
+		if suspending && serr == nil {
+			recordStopOperation(ctx, "power off after suspend")
+
+			c.logger().Infof("retrying power off of %s after in-flight suspend completed", c.ExecConfig.ID)
+			_, err = c.vm.WaitForResult(ctx, powerOff)
+		}
+	}
+
+	if err != nil {
+
+		// It is possible the VM has finally shutdown in between, ignore the error in that case
+		if terr, ok := err.(task.Error); ok {
+			switch terr := terr.Fault().(type) {
+			case *types.InvalidPowerState:
+				if terr.ExistingState == types.VirtualMachinePowerStatePoweredOff {
+					c.logger().Warnf("power off %s task skipped (state was already %s)", c.ExecConfig.ID, terr.ExistingState)
+					return nil
+				}
+				c.logger().Warnf("invalid power state during power off: %s", terr.ExistingState)
+
+			case *types.GenericVmConfigFault:
+
+				// Check if the poweroff task was canceled due to a concurrent guest shutdown
+				if len(terr.FaultMessage) > 0 && terr.FaultMessage[0].Key == vmNotSuspendedKey {
+					c.logger().Infof("power off %s task skipped due to guest shutdown", c.ExecConfig.ID)
+					return nil
+				}
+				perr := PowerOffConfigFaultError{ID: c.ExecConfig.ID, Reasons: faultMessages(terr.FaultMessage), err: err}
+				c.logger().Warnf("generic vm config fault during power off: %s", perr)
+				return perr
+
+			default:
+				c.logger().Warnf("hard power off failed due to: %#v", terr)
+			}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// migrationTasks are the task descriptions of the operations that move a VM between hosts or datastores
+var migrationTasks = map[string]bool{
+	"VirtualMachine.migrate":  true,
+	"VirtualMachine.relocate": true,
+	"Drm.ExecuteVMotionLRO":   true,
+}
+
+// isMigrating returns true if the container VM has a migration in progress, during which guest and power
+// operations can fail transiently
+func (c *containerBase) isMigrating(ctx context.Context) (bool, error) {
+	infos, err := c.recentTasks(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return migrating(infos), nil
+}
+
+// migrating returns true if any of the tasks is an unfinished migration
+func migrating(infos []types.TaskInfo) bool {
+	for _, info := range infos {
+		if !migrationTasks[info.DescriptionId] {
+			continue
+		}
+
+		if info.State == types.TaskInfoStateQueued || info.State == types.TaskInfoStateRunning {
+			return true
+		}
+	}
+
+	return false
+}
+
+// waitForMigration waits up to the session's MigrationWait for an in-progress migration to complete. The
+// caller proceeds regardless, so failures to determine migration state are only logged.
+func (c *containerBase) waitForMigration(ctx context.Context) {
+	cs, ok := c.ExecConfig.Sessions[c.ExecConfig.ID]
+	if !ok || cs.MigrationWait <= 0 {
+		return
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, cs.MigrationWait)
+	defer cancel()
+
+	ticker := time.NewTicker(migrationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		moving, err := c.isMigrating(wctx)
+		if err != nil {
+			c.logger().Warnf("unable to determine whether %s is migrating: %s", c.ExecConfig.ID, err)
+			return
+		}
+
+		if !moving {
+			return
+		}
+
+		c.logger().Infof("waiting for migration of %s to complete", c.ExecConfig.ID)
+
+		select {
+		case <-ticker.C:
+		case <-wctx.Done():
+			c.logger().Warnf("migration of %s still in progress after %s, proceeding", c.ExecConfig.ID, cs.MigrationWait)
+			return
+		}
+	}
+}
+
+// recentTasks returns the info of the recent tasks on the container VM, ordered by start time with
+// queued tasks last
+func (c *containerBase) recentTasks(ctx context.Context) ([]types.TaskInfo, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return nil, NotYetExistError{c.ExecConfig.ID}
+	}
+
+	var o mo.VirtualMachine
+	if err := c.vm.Properties(ctx, c.vm.Reference(), []string{"recentTask"}, &o); err != nil {
+		return nil, err
+	}
+
+	if len(o.RecentTask) == 0 {
+		return nil, nil
+	}
+
+	var recent []mo.Task
+	p := property.DefaultCollector(c.vm.Vim25())
+	if err := p.Retrieve(ctx, o.RecentTask, []string{"info"}, &recent); err != nil {
+		return nil, err
+	}
+
+	infos := make([]types.TaskInfo, len(recent))
+	for i := range recent {
+		infos[i] = recent[i].Info
+	}
+
+	sort.Sort(byStartTime(infos))
+	return infos, nil
+}
+
+// byStartTime orders tasks by start time, with tasks that haven't started ordered by queue time after them
+type byStartTime []types.TaskInfo
+
+func (t byStartTime) Len() int      { return len(t) }
+func (t byStartTime) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t byStartTime) Less(i, j int) bool {
+	a, b := t[i].StartTime, t[j].StartTime
+	switch {
+	case a != nil && b != nil:
+		return a.Before(*b)
+	case a != nil:
+		return true
+	case b != nil:
+		return false
+	}
+	return t[i].QueueTime.Before(t[j].QueueTime)
+}
+
+// moveToResourcePool moves the container VM into pool and refreshes Runtime. The VM is left in its
+// original pool if the move fails.
+func (c *containerBase) moveToResourcePool(ctx context.Context, pool types.ManagedObjectReference) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	// MoveIntoResourcePool completes synchronously rather than returning a task
+	req := types.MoveIntoResourcePool{
+		This: pool,
+		List: []types.ManagedObjectReference{c.vm.Reference()},
+	}
+
+	if _, err := methods.MoveIntoResourcePool(ctx, c.vm.Vim25(), &req); err != nil {
+		if soap.IsSoapFault(err) {
+			if _, ok := soap.ToSoapFault(err).VimFault().(types.InvalidArgument); ok {
+				return fmt.Errorf("resource pool %s is not compatible with %s: %s", pool.Value, c.ExecConfig.ID, err)
+			}
+		}
+		return err
+	}
+
+	c.logger().Infof("moved %s to resource pool %s", c.ExecConfig.ID, pool.Value)
+
+	var o mo.VirtualMachine
+	if err := c.vm.Properties(ctx, c.vm.Reference(), []string{"runtime"}, &o); err != nil {
+		return err
+	}
+
+	c.Runtime = &o.Runtime
+	return nil
+}
+
+// waitForSuspend waits for any suspend task in flight on the container VM to finish, returning whether
+// one was found
+func (c *containerBase) waitForSuspend(ctx context.Context) (bool, error) {
+	recent, err := c.recentTasks(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	found := false
+	for _, info := range recent {
+		if info.DescriptionId != "VirtualMachine.suspend" {
+			continue
+		}
+
+		if info.State != types.TaskInfoStateRunning && info.State != types.TaskInfoStateQueued {
+			continue
+		}
+
+		found = true
+		c.logger().Infof("waiting for in-flight suspend task %s of %s", info.Task.Value, c.ExecConfig.ID)
+
+		// only completion matters, not whether the suspend succeeded
+		if err := object.NewTask(c.vm.Vim25(), info.Task).Wait(ctx); err != nil && ctx.Err() != nil {
+			return found, ctx.Err()
+		}
+	}
+
+	return found, nil
+}
+
+// cancelTask requests cancellation of the task and waits for it to reach a terminal state. A task that
+// completes, fails or has already finished before the cancellation takes effect is not an error.
+func (c *containerBase) cancelTask(ctx context.Context, ref types.ManagedObjectReference) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(ref.Value))
+
+	req := types.CancelTask{
+		This: ref,
+	}
+
+	if _, err := methods.CancelTask(ctx, c.vm.Vim25(), &req); err != nil {
+		if !soap.IsSoapFault(err) {
+			return err
+		}
+
+		switch soap.ToSoapFault(err).VimFault().(type) {
+		case types.InvalidState:
+			// the task has already finished
+			c.logger().Debugf("task %s for %s not cancellable: %s", ref.Value, c.ExecConfig.ID, err)
+			return nil
+		case types.NotSupported:
+			c.logger().Warnf("task %s for %s does not support cancellation, waiting for completion", ref.Value, c.ExecConfig.ID)
+		default:
+			return err
+		}
+	}
+
+	_, err := object.NewTask(c.vm.Vim25(), ref).WaitForResult(ctx, nil)
+	if err != nil {
+		if terr, ok := err.(task.Error); ok {
+			if _, ok := terr.Fault().(*types.RequestCanceled); ok {
+				c.logger().Infof("task %s for %s cancelled", ref.Value, c.ExecConfig.ID)
+				return nil
+			}
+		}
+
+		// any other fault is still a terminal state for the task
+		if _, ok := err.(task.Error); ok {
+			c.logger().Infof("task %s for %s failed before cancellation: %s", ref.Value, c.ExecConfig.ID, err)
+			return nil
+		}
+
+		return err
+	}
+
+	c.logger().Infof("task %s for %s completed before cancellation", ref.Value, c.ExecConfig.ID)
+	return nil
+}
+
+// syncGuest has the tether flush the guest filesystem caches, for a crash consistent snapshot when
+// quiescing via tools isn't available. The flush is complete once syncGuest returns.
+func (c *containerBase) syncGuest(ctx context.Context) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if err := c.startGuestProgram(ctx, "sync", ""); err != nil {
+		return fmt.Errorf("unable to sync %s: %s", c.ExecConfig.ID, err)
+	}
+
+	return nil
+}
+
+// snapshot takes a snapshot of the container VM, returning the reference of the new snapshot. If quiesce
+// is requested, guest tools must be running to quiesce the guest filesystem - a crash consistent snapshot
+// is never substituted.
+func (c *containerBase) snapshot(ctx context.Context, name, description string, quiesce bool) (types.ManagedObjectReference, error) {
+	// make sure we have vm
+	if c.vm == nil {
+		return types.ManagedObjectReference{}, NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	if quiesce {
+		running, err := c.vm.IsToolsRunning(ctx)
+		if err != nil {
+			return types.ManagedObjectReference{}, err
+		}
+
+		if !running {
+			return types.ManagedObjectReference{}, fmt.Errorf("unable to take quiesced snapshot of %s: guest tools not running", c.ExecConfig.ID)
+		}
+	}
+
+	c.logger().Infof("taking snapshot %q of %s (quiesce: %t)", name, c.ExecConfig.ID, quiesce)
+	info, err := c.vm.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
+		return c.vm.CreateSnapshot(ctx, name, description, false, quiesce)
+	})
+	if err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+
+	ref, ok := info.Result.(types.ManagedObjectReference)
+	if !ok {
+		return types.ManagedObjectReference{}, fmt.Errorf("unexpected result from snapshot of %s: %#v", c.ExecConfig.ID, info.Result)
+	}
+
+	return ref, nil
+}
+
+// removeSnapshot removes the snapshot, and optionally its children, from the container VM
+func (c *containerBase) removeSnapshot(ctx context.Context, ref types.ManagedObjectReference, removeChildren bool) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	c.logger().Infof("removing snapshot %s of %s (children: %t)", ref, c.ExecConfig.ID, removeChildren)
+	_, err := c.vm.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
+		return c.vm.RemoveSnapshot(ctx, ref, removeChildren, true)
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.refresh(ctx)
+}
+
+// revertToSnapshot reverts the container VM to the snapshot. If the revert is rejected due to the current
+// power state the VM is powered off and the revert retried.
+func (c *containerBase) revertToSnapshot(ctx context.Context, ref types.ManagedObjectReference, suppressPowerOn bool) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	revert := func(ctx context.Context) (tasks.Task, error) {
+		return c.vm.RevertToSnapshotByRef(ctx, ref, suppressPowerOn)
+	}
+
+	c.logger().Infof("reverting %s to snapshot %s", c.ExecConfig.ID, ref)
+	_, err := c.vm.WaitForResult(ctx, revert)
+	if err != nil {
+		terr, ok := err.(task.Error)
+		if !ok {
+			return err
+		}
+
+		ips, ok := terr.Fault().(*types.InvalidPowerState)
+		if !ok {
+			return err
+		}
+
+		c.logger().Warnf("invalid power state during revert of %s: %s, powering off", c.ExecConfig.ID, ips.ExistingState)
+		if err = c.poweroff(ctx); err != nil {
+			return err
+		}
+
+		if _, err = c.vm.WaitForResult(ctx, revert); err != nil {
+			return err
+		}
+	}
+
+	return c.refresh(ctx)
+}
+
+// coreDump captures the memory of the running container VM to the datastore file at datastorePath, for
+// post-mortem analysis of a hung container, e.g. with vmss2core. The memory is captured via a temporary
+// memory snapshot, so no guest cooperation is needed, and the snapshot is removed once copied.
+func (c *containerBase) coreDump(ctx context.Context, datastorePath string) error {
+	// make sure we have vm
+	if c.vm == nil {
+		return NotYetExistError{c.ExecConfig.ID}
+	}
+
+	defer trace.End(trace.Begin(c.ExecConfig.ID))
+
+	c.logger().Infof("capturing memory of %s to %s", c.ExecConfig.ID, datastorePath)
+	info, err := c.vm.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
+		return c.vm.CreateSnapshot(ctx, "core dump", "temporary snapshot for memory capture", true, false)
+	})
+	if err != nil {
+		if isNotSupported(err) {
+			return fmt.Errorf("memory capture of %s not supported: %s", c.ExecConfig.ID, err)
+		}
+		return err
+	}
+
+	ref, ok := info.Result.(types.ManagedObjectReference)
+	if !ok {
+		return fmt.Errorf("unexpected result from memory snapshot of %s: %#v", c.ExecConfig.ID, info.Result)
+	}
+
+	defer func() {
+		if err := c.removeSnapshot(ctx, ref, false); err != nil {
+			c.logger().Errorf("unable to remove memory snapshot %s of %s: %s", ref, c.ExecConfig.ID, err)
+		}
+	}()
+
+	var o mo.VirtualMachine
+	if err := c.vm.Properties(ctx, c.vm.Reference(), []string{"layoutEx"}, &o); err != nil {
+		return err
+	}
+
+	src, err := snapshotMemoryFile(o.LayoutEx, ref)
+	if err != nil {
+		return fmt.Errorf("unable to find memory of %s: %s", c.ExecConfig.ID, err)
+	}
+
+	fm := object.NewFileManager(c.vm.Vim25())
+	_, err = c.vm.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
+		return fm.CopyDatastoreFile(ctx, src, c.vm.Datacenter, datastorePath, c.vm.Datacenter, false)
+	})
+	return err
+}
+
+// isNotSupported reports whether err is a NotSupported fault, either of a task or of the call itself
+func isNotSupported(err error) bool {
+	if terr, ok := err.(task.Error); ok {
+		_, ok = terr.Fault().(*types.NotSupported)
+		return ok
+	}
+
+	if soap.IsSoapFault(err) {
+		_, ok := soap.ToSoapFault(err).VimFault().(types.NotSupported)
+		return ok
+	}
+
+	return false
+}
+
+// snapshotMemoryFile returns the datastore path of the file holding the memory of the snapshot, which is
+// the snapshot data file itself if the memory isn't held separately
+func snapshotMemoryFile(layout *types.VirtualMachineFileLayoutEx, ref types.ManagedObjectReference) (string, error) {
+	if layout == nil {
+		return "", errors.New("no file layout")
+	}
+
+	for _, snap := range layout.Snapshot {
+		if snap.Key != ref {
+			continue
+		}
+
+		var data string
+		for _, f := range layout.File {
+			if f.Key == snap.MemoryKey && f.Type == "snapshotMemory" {
+				return f.Name, nil
+			}
+			if f.Key == snap.DataKey {
+				data = f.Name
+			}
+		}
+
+		if data != "" {
+			return data, nil
+		}
+		return "", fmt.Errorf("no memory file for snapshot %s", ref.Value)
+	}
+
+	return "", fmt.Errorf("snapshot %s not found in layout", ref.Value)
+}
+
+func (c *containerBase) waitForPowerState(ctx context.Context, max time.Duration, state types.VirtualMachinePowerState) (bool, error) {
+	_, timeout, err := c.waitForAnyPowerState(ctx, max, state)
+	return timeout, err
+}
+
+// waitForAnyPowerState waits up to max for the VM to reach any of the supplied power states, returning
+// the state reached and whether the wait timed out. The property collector is supplemented by direct
+// polling in the final stretch of the wait so a state change isn't detected late - polling is confined
+// to that window to avoid additional API load early in the wait.
+func (c *containerBase) waitForAnyPowerState(ctx context.Context, max time.Duration, states ...types.VirtualMachinePowerState) (types.VirtualMachinePowerState, bool, error) {
 	defer trace.End(trace.Begin(c.ExecConfig.ID))
+	began := time.Now()
 	timeout, cancel := context.WithTimeout(ctx, max)
 	defer cancel()
 
-	err := c.vm.WaitForPowerState(timeout, state)
-	if err != nil {
-		return timeout.Err() != nil, err
+	// the last state observed by either waiter, reported if the wait times out
+	var mu sync.Mutex
+	var last types.VirtualMachinePowerState
+
+	matches := func(ps types.VirtualMachinePowerState) bool {
+		mu.Lock()
+		last = ps
+		mu.Unlock()
+
+		for _, state := range states {
+			if ps == state {
+				return true
+			}
+		}
+		return false
 	}
 
-	return false, nil
+	type result struct {
+		state types.VirtualMachinePowerState
+		err   error
+	}
+
+	// buffered so that the loser doesn't block once we've returned
+	results := make(chan result, 2)
+
+	go func() {
+		var reached types.VirtualMachinePowerState
+
+		p := property.DefaultCollector(c.vm.Vim25())
+		err := property.Wait(timeout, p, c.vm.Reference(), []string{object.PropRuntimePowerState}, func(pc []types.PropertyChange) bool {
+			for _, change := range pc {
+				if change.Name != object.PropRuntimePowerState || change.Val == nil {
+					continue
+				}
+
+				if ps := change.Val.(types.VirtualMachinePowerState); matches(ps) {
+					reached = ps
+					return true
+				}
+			}
+			return false
+		})
+
+		results <- result{state: reached, err: err}
+	}()
+
+	go func() {
+		select {
+		case <-time.After(max - powerStatePollWindow):
+		case <-timeout.Done():
+			return
+		}
+
+		ticker := time.NewTicker(powerStatePollInterval)
+		defer ticker.Stop()
+
+		for {
+			if ps, err := c.vm.PowerState(timeout); err == nil && matches(ps) {
+				results <- result{state: ps}
+				return
+			}
+
+			select {
+			case <-ticker.C:
+			case <-timeout.Done():
+				return
+			}
+		}
+	}()
+
+	res := <-results
+	if res.err != nil {
+		if timeout.Err() != nil && ctx.Err() == nil {
+			mu.Lock()
+			defer mu.Unlock()
+			return "", true, PowerStateTimeoutError{ID: c.ExecConfig.ID, Targets: states, Last: last, Elapsed: time.Since(began)}
+		}
+		return "", timeout.Err() != nil, res.err
+	}
+
+	return res.state, false, nil
 }
@@ -0,0 +1,888 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/vmware/govmomi/task"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"github.com/vmware/vic/lib/config/executor"
+	"github.com/vmware/vic/pkg/vsphere/extraconfig"
+	"github.com/vmware/vic/pkg/vsphere/extraconfig/vmomi"
+	"github.com/vmware/vic/pkg/vsphere/session"
+	"github.com/vmware/vic/pkg/vsphere/simulator"
+	"github.com/vmware/vic/pkg/vsphere/tasks"
+	"github.com/vmware/vic/pkg/vsphere/vm"
+)
+
+func TestLogger(t *testing.T) {
+	base := newBase(nil, nil, nil)
+
+	// falls back to the package logger
+	assert.NotNil(t, base.logger())
+	assert.Empty(t, base.logger().Data)
+
+	entry := log.WithField("tenant", "test")
+	base.setLogger(entry)
+	assert.Equal(t, entry, base.logger())
+}
+
+func TestGuestSignal(t *testing.T) {
+	base := newBase(nil, nil, nil)
+	base.ExecConfig.ID = "abc"
+	base.ExecConfig.Sessions = map[string]*executor.SessionConfig{
+		"abc": {},
+	}
+
+	// symbolic by default
+	assert.Equal(t, "KILL", base.guestSignal(string(ssh.SIGKILL)))
+
+	base.ExecConfig.Sessions["abc"].NumericSignals = true
+	assert.Equal(t, "9", base.guestSignal(string(ssh.SIGKILL)))
+	assert.Equal(t, "15", base.guestSignal(string(ssh.SIGTERM)))
+
+	// already numeric or unknown values pass through
+	assert.Equal(t, "3", base.guestSignal("3"))
+	assert.Equal(t, "WINCH", base.guestSignal("WINCH"))
+}
+
+func TestStopBudget(t *testing.T) {
+	ctx := context.Background()
+
+	// no budget in the context means no limit
+	assert.NoError(t, spendStopBudget(ctx, "power off"))
+
+	b := newStopBudget("abc", 1, nil)
+	b.maxOps = 2
+	ctx = context.WithValue(ctx, stopBudgetKey{}, b)
+
+	assert.NoError(t, spendStopBudget(ctx, "kill -TERM"))
+	assert.NoError(t, spendStopBudget(ctx, "kill -KILL"))
+
+	err := spendStopBudget(ctx, "kill -KILL")
+	if assert.IsType(t, StopExhaustedError{}, err) {
+		assert.Equal(t, 2, err.(StopExhaustedError).Operations)
+	}
+
+	// the final power off is counted but never refused
+	recordStopOperation(ctx, "power off")
+	assert.Equal(t, 3, b.ops)
+
+	// the default wait caps the duration of the stop
+	b = newStopBudget("abc", 1, nil)
+	b.start = time.Now().Add(-stopMaxDuration - time.Second)
+	assert.IsType(t, StopExhaustedError{}, b.spend("kill -KILL"))
+}
+
+func TestStopBudgetExplicitWait(t *testing.T) {
+	// docker stop -t 200 waits 200s for each of the stop signal and SIGKILL, longer than stopMaxDuration
+	wait := int32(200)
+	b := newStopBudget("abc", 1, &wait)
+
+	assert.NoError(t, b.spend("kill -TERM"))
+	b.start = b.start.Add(-time.Duration(wait) * time.Second)
+	assert.NoError(t, b.spend("kill -KILL"))
+	b.start = b.start.Add(-time.Duration(wait) * time.Second)
+
+	assert.True(t, time.Since(b.start) > stopMaxDuration)
+	assert.NoError(t, b.spend("kill -KILL"))
+}
+
+func TestStopBudgetSignalAll(t *testing.T) {
+	// SignalAll sends every session its stop signal and SIGKILL
+	sessions := stopMaxOperations
+	b := newStopBudget("abc", sessions, nil)
+
+	for i := 0; i < sessions; i++ {
+		assert.NoError(t, b.spend("kill -TERM"))
+		assert.NoError(t, b.spend("kill -KILL"))
+	}
+}
+
+func TestMergeEnv(t *testing.T) {
+	env := []string{"PATH=/bin", "HOME=/root"}
+
+	merged := mergeEnv(env, map[string]string{
+		"HOME": "/home/user",
+		"TERM": "xterm",
+		"LANG": "C",
+	})
+	assert.Equal(t, []string{"PATH=/bin", "HOME=/home/user", "LANG=C", "TERM=xterm"}, merged)
+
+	// the original is untouched
+	assert.Equal(t, []string{"PATH=/bin", "HOME=/root"}, env)
+
+	assert.Equal(t, env, mergeEnv(env, nil))
+}
+
+func TestReference(t *testing.T) {
+	base := newBase(nil, nil, nil)
+
+	assert.False(t, base.hasVM())
+	assert.Equal(t, types.ManagedObjectReference{}, base.reference())
+}
+
+func TestByStartTime(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Minute)
+
+	tasks := []types.TaskInfo{
+		{Key: "queued", QueueTime: now},
+		{Key: "second", StartTime: &now},
+		{Key: "first", StartTime: &earlier},
+		{Key: "queued-earlier", QueueTime: earlier},
+	}
+	sort.Sort(byStartTime(tasks))
+
+	var keys []string
+	for _, info := range tasks {
+		keys = append(keys, info.Key)
+	}
+	assert.Equal(t, []string{"first", "second", "queued-earlier", "queued"}, keys)
+}
+
+func TestCommand(t *testing.T) {
+	base := newBase(nil, nil, nil)
+	base.ExecConfig.ID = "abc"
+	base.ExecConfig.Sessions = map[string]*executor.SessionConfig{
+		"abc": {
+			Cmd: executor.Cmd{
+				Path: "/bin/sleep",
+				Args: []string{"/bin/sleep", "60"},
+				Dir:  "/tmp",
+			},
+		},
+	}
+
+	args, dir, err := base.command("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/bin/sleep", "60"}, args)
+	assert.Equal(t, "/tmp", dir)
+
+	_, _, err = base.command("missing")
+	assert.Error(t, err)
+}
+
+func TestReadyKey(t *testing.T) {
+	base := newBase(nil, nil, nil)
+	base.ExecConfig.ID = "abc"
+	base.ExecConfig.Sessions = map[string]*executor.SessionConfig{
+		"abc": {},
+	}
+
+	key, err := base.readyKey("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, base.startedKey("abc"), key)
+
+	base.ExecConfig.Sessions["abc"].ReadyKey = "guestinfo.app.ready"
+	key, err = base.readyKey("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "guestinfo.app.ready", key)
+
+	base.ExecConfig.Sessions["abc"].ReadyKey = "app ready"
+	_, err = base.readyKey("abc")
+	assert.Error(t, err)
+}
+
+func TestGuestWritable(t *testing.T) {
+	cfg := &executor.ExecutorConfig{
+		Sessions: map[string]*executor.SessionConfig{
+			"abc": {},
+		},
+	}
+
+	key := func(field string) string {
+		return extraconfig.CalculateKeys(cfg, field, "")[0]
+	}
+
+	assert.True(t, guestWritable(key("Sessions.abc.Started")))
+	assert.True(t, guestWritable(key("AppliedConfigVersion")))
+	assert.False(t, guestWritable(key("Sessions.abc.StopSignal")))
+	assert.False(t, guestWritable(key("RestartCount")))
+}
+
+func TestStopSignalArg(t *testing.T) {
+	base := newBase(nil, nil, nil)
+	base.ExecConfig.ID = "abc"
+	base.ExecConfig.Sessions = map[string]*executor.SessionConfig{
+		"abc": {},
+	}
+
+	assert.Equal(t, "TERM", base.stopSignalArg(string(ssh.SIGTERM)))
+
+	base.ExecConfig.Sessions["abc"].SignalGroup = true
+	assert.Equal(t, "-TERM", base.stopSignalArg(string(ssh.SIGTERM)))
+
+	base.ExecConfig.Sessions["abc"].NumericSignals = true
+	assert.Equal(t, "-15", base.stopSignalArg(string(ssh.SIGTERM)))
+	assert.Equal(t, "9 pid:-1", base.broadcastSignalArg(string(ssh.SIGKILL)))
+}
+
+func TestSessionAuth(t *testing.T) {
+	base := newBase(nil, nil, nil)
+	base.ExecConfig.ID = "abc"
+	base.ExecConfig.Sessions = map[string]*executor.SessionConfig{
+		"abc": {},
+	}
+
+	assert.Equal(t, "abc", base.guestAuth().Username)
+
+	base.ExecConfig.Sessions["abc"].GuestUser = "tether"
+	assert.Equal(t, "tether", base.guestAuth().Username)
+	assert.Equal(t, "other", base.sessionAuth("other").Username)
+}
+
+func TestPowerOffConfigFaultError(t *testing.T) {
+	reasons := faultMessages([]types.LocalizableMessage{
+		{Key: "msg.one", Message: "The operation is not allowed"},
+		{Key: "msg.two"},
+	})
+	assert.Equal(t, []string{"The operation is not allowed", "msg.two"}, reasons)
+
+	err := PowerOffConfigFaultError{ID: "abc", Reasons: reasons}
+	assert.Equal(t, "power off of abc failed: The operation is not allowed; msg.two", err.Error())
+}
+
+func TestDeadlineWait(t *testing.T) {
+	assert.Equal(t, 10*time.Second, deadlineWait(context.Background(), 10*time.Second, 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	w := deadlineWait(ctx, 10*time.Second, 0)
+	assert.True(t, w <= 3*time.Second && w > 2*time.Second, "wait %s not clamped to deadline", w)
+
+	w = deadlineWait(ctx, 10*time.Second, 5*time.Second)
+	assert.True(t, w < 0, "wait %s not reduced by reserve", w)
+
+	assert.Equal(t, time.Second, deadlineWait(ctx, time.Second, 0))
+}
+
+func TestPowerOffContext(t *testing.T) {
+	budget := newStopBudget("a", 1, nil)
+	parent := context.WithValue(context.Background(), stopBudgetKey{}, budget)
+
+	// without a deadline the caller's context is kept
+	ctx, cancel := powerOffContext(parent)
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+	cancel()
+
+	// a deadline that has already passed still leaves the power off its reserve
+	expired, ecancel := context.WithDeadline(parent, time.Now().Add(-time.Second))
+	defer ecancel()
+
+	ctx, cancel = powerOffContext(expired)
+	defer cancel()
+
+	assert.NoError(t, ctx.Err())
+	deadline, ok := ctx.Deadline()
+	if assert.True(t, ok) {
+		assert.True(t, time.Until(deadline) > powerOffReserve-time.Second, "deadline %s not bounded by the reserve", deadline)
+	}
+	assert.Equal(t, budget, ctx.Value(stopBudgetKey{}))
+}
+
+func TestDiskPaths(t *testing.T) {
+	config := &types.VirtualMachineConfigInfo{
+		Hardware: types.VirtualHardware{
+			Device: []types.BaseVirtualDevice{
+				&types.VirtualE1000{},
+				&types.VirtualDisk{
+					CapacityInKB: 8 * 1024 * 1024,
+					VirtualDevice: types.VirtualDevice{
+						Backing: &types.VirtualDiskFlatVer2BackingInfo{
+							VirtualDeviceFileBackingInfo: types.VirtualDeviceFileBackingInfo{
+								FileName: "[datastore1] abc/abc.vmdk",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	base := newBase(nil, config, nil)
+	disks, err := base.diskPaths(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []DiskInfo{{Path: "[datastore1] abc/abc.vmdk", CapacityKB: 8 * 1024 * 1024}}, disks)
+
+	base = newBase(nil, &types.VirtualMachineConfigInfo{}, nil)
+	disks, err = base.diskPaths(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, disks)
+}
+
+func TestDiff(t *testing.T) {
+	before := newBase(nil, &types.VirtualMachineConfigInfo{ChangeVersion: "1"}, &types.VirtualMachineRuntimeInfo{
+		PowerState: types.VirtualMachinePowerStatePoweredOff,
+	})
+	before.ExecConfig.Sessions = map[string]*executor.SessionConfig{
+		"abc": {},
+		"old": {},
+	}
+
+	assert.Empty(t, before.diff(before))
+
+	after := newBase(nil, &types.VirtualMachineConfigInfo{ChangeVersion: "2"}, &types.VirtualMachineRuntimeInfo{
+		PowerState: types.VirtualMachinePowerStatePoweredOn,
+	})
+	after.ExecConfig.Sessions = map[string]*executor.SessionConfig{
+		"abc": {Started: "true"},
+		"new": {},
+	}
+
+	assert.Equal(t, []string{
+		"power state poweredOff -> poweredOn",
+		`session abc started "" -> "true"`,
+		"session new added",
+		"session old removed",
+		"config version 1 -> 2",
+	}, before.diff(after))
+}
+
+func TestNewBaseFromExtraConfig(t *testing.T) {
+	cfg := executor.ExecutorConfig{
+		Common: executor.Common{
+			ID: "abc",
+		},
+		Sessions: map[string]*executor.SessionConfig{
+			"abc": {
+				Cmd: executor.Cmd{
+					Args: []string{"/bin/true"},
+				},
+			},
+		},
+	}
+
+	sink := make(map[string]string)
+	extraconfig.Encode(extraconfig.MapSink(sink), cfg)
+
+	base := newBaseFromExtraConfig(vmomi.OptionValueFromMap(sink))
+	assert.False(t, base.hasVM())
+	assert.Equal(t, "abc", base.ExecConfig.ID)
+
+	args, _, err := base.command("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/bin/true"}, args)
+
+	assert.IsType(t, NotYetExistError{}, base.destroy(context.Background()))
+}
+
+func TestRoutableIPv4(t *testing.T) {
+	assert.Equal(t, "", routableIPv4(nil))
+	assert.Equal(t, "", routableIPv4([]string{"127.0.0.1", "169.254.10.1", "fe80::1", "0.0.0.0"}))
+	assert.Equal(t, "10.0.0.5", routableIPv4([]string{"fe80::1", "169.254.10.1", "10.0.0.5", "192.168.1.1"}))
+}
+
+func TestHost(t *testing.T) {
+	ref := types.ManagedObjectReference{Type: "HostSystem", Value: "host-1"}
+
+	base := newBase(nil, nil, &types.VirtualMachineRuntimeInfo{Host: &ref})
+	host, err := base.host(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, ref, host)
+
+	base = newBase(nil, nil, &types.VirtualMachineRuntimeInfo{})
+	_, err = base.host(context.Background())
+	assert.Error(t, err)
+}
+
+func TestStartAll(t *testing.T) {
+	var bases []*containerBase
+	for _, id := range []string{"a", "b", "c"} {
+		base := newBase(nil, nil, nil)
+		base.ExecConfig.ID = id
+		bases = append(bases, base)
+	}
+
+	results := startAll(context.Background(), bases, 2, time.Millisecond)
+	assert.Len(t, results, 3)
+	for _, id := range []string{"a", "b", "c"} {
+		assert.Equal(t, NotYetExistError{id}, results[id])
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results = startAll(ctx, bases, 1, time.Second)
+	assert.Len(t, results, 3)
+	assert.Equal(t, context.Canceled, results["c"])
+}
+
+func TestNormalizeSignal(t *testing.T) {
+	for in, out := range map[string]string{"TERM": "TERM", "SIGQUIT": "QUIT", "sigint": "INT", "9": "9"} {
+		sig, err := normalizeSignal(in)
+		assert.NoError(t, err)
+		assert.Equal(t, out, sig)
+	}
+
+	for _, in := range []string{"", "SIGBOGUS", "99"} {
+		_, err := normalizeSignal(in)
+		assert.Error(t, err)
+	}
+}
+
+func TestSignalName(t *testing.T) {
+	assert.Equal(t, "", signalName(0))
+	assert.Equal(t, "TERM", signalName(15))
+	assert.Equal(t, "KILL", signalName(9))
+	assert.Equal(t, "64", signalName(64))
+}
+
+func TestCheckGuestArgs(t *testing.T) {
+	assert.NoError(t, checkGuestArgs("kill", "TERM"))
+	assert.Error(t, checkGuestArgs("kill", strings.Repeat("x", defaultGuestArgsMax+1)))
+
+	defer func(max int) { Config.GuestArgsMax = max }(Config.GuestArgsMax)
+	Config.GuestArgsMax = 4
+
+	assert.NoError(t, checkGuestArgs("kill", "TERM"))
+	assert.Error(t, checkGuestArgs("kill", "-TERM"))
+}
+
+func TestMigrating(t *testing.T) {
+	assert.False(t, migrating(nil))
+	assert.False(t, migrating([]types.TaskInfo{
+		{DescriptionId: "VirtualMachine.powerOn", State: types.TaskInfoStateRunning},
+		{DescriptionId: "VirtualMachine.migrate", State: types.TaskInfoStateSuccess},
+	}))
+	assert.True(t, migrating([]types.TaskInfo{
+		{DescriptionId: "VirtualMachine.powerOn", State: types.TaskInfoStateSuccess},
+		{DescriptionId: "Drm.ExecuteVMotionLRO", State: types.TaskInfoStateRunning},
+	}))
+}
+
+func TestPoweroffGroup(t *testing.T) {
+	var bases []*containerBase
+	for _, id := range []string{"a", "b"} {
+		base := newBase(nil, nil, nil)
+		base.ExecConfig.ID = id
+		bases = append(bases, base)
+	}
+
+	results := poweroffGroup(context.Background(), bases, 4)
+	assert.Len(t, results, 2)
+	assert.Equal(t, NotYetExistError{"b"}, results["b"])
+}
+
+func TestShutdownNoPrimarySession(t *testing.T) {
+	base := newBase(&vm.VirtualMachine{}, nil, nil)
+	base.ExecConfig.ID = "a"
+
+	// there is nothing to signal, so the caller is left to power off
+	sig, err := base.shutdown(context.Background(), nil)
+	assert.Equal(t, hardPowerOff, sig)
+	assert.Error(t, err)
+}
+
+func TestResourceAllocation(t *testing.T) {
+	base := newBase(nil, &types.VirtualMachineConfigInfo{
+		CpuAllocation: &types.ResourceAllocationInfo{
+			Reservation: 1000,
+			Limit:       2000,
+			Shares:      &types.SharesInfo{Shares: 4000, Level: types.SharesLevelHigh},
+		},
+	}, nil)
+
+	alloc, err := base.resourceAllocation(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, AllocationSettings{Reservation: 1000, Limit: 2000, Shares: 4000, SharesLevel: types.SharesLevelHigh}, alloc.CPU)
+	assert.Equal(t, AllocationSettings{Limit: -1}, alloc.Memory)
+}
+
+func TestPowerStateTimeoutError(t *testing.T) {
+	err := PowerStateTimeoutError{
+		ID:      "abc",
+		Targets: []types.VirtualMachinePowerState{types.VirtualMachinePowerStatePoweredOff},
+		Last:    types.VirtualMachinePowerStatePoweredOn,
+		Elapsed: 10 * time.Second,
+	}
+
+	assert.Equal(t, `timeout (10s) waiting for abc to reach [poweredOff] (last "poweredOn")`, err.Error())
+}
+
+func TestBootDelay(t *testing.T) {
+	base := newBase(nil, &types.VirtualMachineConfigInfo{}, nil)
+	d, err := base.bootDelay(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), d)
+
+	base = newBase(nil, &types.VirtualMachineConfigInfo{BootOptions: &types.VirtualMachineBootOptions{BootDelay: 1500}}, nil)
+	d, err = base.bootDelay(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, d)
+}
+
+func TestSnapshotMemoryFile(t *testing.T) {
+	ref := types.ManagedObjectReference{Type: "VirtualMachineSnapshot", Value: "snapshot-1"}
+
+	layout := &types.VirtualMachineFileLayoutEx{
+		File: []types.VirtualMachineFileLayoutExFileInfo{
+			{Key: 0, Name: "[ds] abc/abc.vmx", Type: "config"},
+			{Key: 4, Name: "[ds] abc/abc-Snapshot1.vmsn", Type: "snapshotData"},
+			{Key: 5, Name: "[ds] abc/abc-Snapshot1.vmem", Type: "snapshotMemory"},
+		},
+		Snapshot: []types.VirtualMachineFileLayoutExSnapshotLayout{
+			{Key: ref, DataKey: 4, MemoryKey: 5},
+		},
+	}
+
+	name, err := snapshotMemoryFile(layout, ref)
+	assert.NoError(t, err)
+	assert.Equal(t, "[ds] abc/abc-Snapshot1.vmem", name)
+
+	// memory held in the snapshot data file
+	layout.Snapshot[0].MemoryKey = 0
+	name, err = snapshotMemoryFile(layout, ref)
+	assert.NoError(t, err)
+	assert.Equal(t, "[ds] abc/abc-Snapshot1.vmsn", name)
+
+	_, err = snapshotMemoryFile(layout, types.ManagedObjectReference{Type: "VirtualMachineSnapshot", Value: "snapshot-2"})
+	assert.Error(t, err)
+}
+
+func TestIsNotSupported(t *testing.T) {
+	err := task.Error{LocalizedMethodFault: &types.LocalizedMethodFault{Fault: &types.NotSupported{}}}
+	assert.True(t, isNotSupported(err))
+
+	err = task.Error{LocalizedMethodFault: &types.LocalizedMethodFault{Fault: &types.InsufficientResourcesFault{}}}
+	assert.False(t, isNotSupported(err))
+
+	assert.False(t, isNotSupported(errors.New("connection reset")))
+}
+
+func TestSignalNumber(t *testing.T) {
+	num, ok := SignalNumber(string(ssh.SIGTERM))
+	assert.True(t, ok)
+	assert.Equal(t, 15, num)
+
+	_, ok = SignalNumber("SIGTERM")
+	assert.False(t, ok)
+}
+
+// simulatorBase returns a containerBase for a powered on VM of the ESX simulator with a primary session,
+// along with the simulator object of the VM for the test to drive the guest with, and a func to tear the
+// simulator down
+func simulatorBase(ctx context.Context, t *testing.T) (*containerBase, *simulator.VirtualMachine, func()) {
+	model := simulator.ESX()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	server := model.Service.NewServer()
+	teardown := func() {
+		server.Close()
+		model.Remove()
+	}
+
+	s, err := session.NewSession(&session.Config{Service: server.URL.String()}).Connect(ctx)
+	if err != nil {
+		teardown()
+		t.Fatal(err)
+	}
+
+	if s, err = s.Populate(ctx); err != nil {
+		teardown()
+		t.Fatal(err)
+	}
+
+	vms, err := s.Finder.VirtualMachineList(ctx, "*")
+	if err != nil {
+		teardown()
+		t.Fatal(err)
+	}
+
+	v := vm.NewVirtualMachineFromVM(ctx, s, vms[0])
+	_, err = v.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
+		return v.PowerOn(ctx)
+	})
+	if err != nil {
+		teardown()
+		t.Fatal(err)
+	}
+
+	base := newBase(v, nil, nil)
+	base.ExecConfig.ID = "primary"
+	base.ExecConfig.Sessions = map[string]*executor.SessionConfig{
+		"primary": {Common: executor.Common{ID: "primary"}},
+	}
+
+	return base, simulator.Map.Get(v.Reference()).(*simulator.VirtualMachine), teardown
+}
+
+// simulatePowerOff powers off the simulated VM as the guest would on exit of the primary session
+func simulatePowerOff(obj *simulator.VirtualMachine) {
+	obj.Runtime.PowerState = types.VirtualMachinePowerStatePoweredOff
+	obj.Summary.Runtime.PowerState = types.VirtualMachinePowerStatePoweredOff
+}
+
+// setExtraConfig sets the keys in the ExtraConfig of the simulated VM as the guest would. The slice is
+// replaced rather than modified in place so the property collector reports the change.
+func setExtraConfig(obj *simulator.VirtualMachine, values map[string]string) {
+	var extra []types.BaseOptionValue
+	for _, value := range obj.Config.ExtraConfig {
+		if _, ok := values[value.GetOptionValue().Key]; !ok {
+			extra = append(extra, value)
+		}
+	}
+
+	obj.Config.ExtraConfig = append(extra, vmomi.OptionValueFromMap(values)...)
+}
+
+// guestPrograms records the programs started in the guest of the simulator, calling exit with each so
+// that the test can simulate the effect of the program
+type guestPrograms struct {
+	mu       sync.Mutex
+	programs []string
+}
+
+func (g *guestPrograms) start(exit func(user string, program string)) {
+	simulator.Map.GuestProcessManager().Start = func(_ types.ManagedObjectReference, auth types.BaseGuestAuthentication, spec types.BaseGuestProgramSpec) (int64, types.BaseMethodFault) {
+		s := spec.GetGuestProgramSpec()
+		program := strings.TrimSpace(s.ProgramPath + " " + s.Arguments)
+		user := auth.(*types.NamePasswordAuthentication).Username
+
+		g.mu.Lock()
+		g.programs = append(g.programs, program)
+		g.mu.Unlock()
+
+		if exit != nil {
+			exit(user, program)
+		}
+		return 1, nil
+	}
+}
+
+func (g *guestPrograms) started() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.programs...)
+}
+
+func TestStopSimulator(t *testing.T) {
+	ctx := context.Background()
+
+	base, obj, teardown := simulatorBase(ctx, t)
+	defer teardown()
+
+	// the primary session exits on SIGKILL
+	var guest guestPrograms
+	guest.start(func(_ string, program string) {
+		if program == "kill KILL" {
+			simulatePowerOff(obj)
+		}
+	})
+
+	wait := int32(1)
+	assert.NoError(t, base.stop(ctx, &wait))
+	assert.Equal(t, []string{"kill TERM", "kill KILL"}, guest.started())
+	assert.Equal(t, types.VirtualMachinePowerStatePoweredOff, obj.Runtime.PowerState)
+}
+
+func TestStopBudgetExhaustedSimulator(t *testing.T) {
+	ctx := context.Background()
+
+	base, obj, teardown := simulatorBase(ctx, t)
+	defer teardown()
+
+	var guest guestPrograms
+	guest.start(nil)
+
+	// a budget spent by earlier attempts refuses the signals but not the final power off
+	b := newStopBudget(base.ExecConfig.ID, 1, nil)
+	b.maxOps = 0
+	ctx = context.WithValue(ctx, stopBudgetKey{}, b)
+
+	assert.NoError(t, base.stop(ctx, nil))
+	assert.Empty(t, guest.started())
+	assert.Equal(t, 1, b.ops)
+	assert.Equal(t, types.VirtualMachinePowerStatePoweredOff, obj.Runtime.PowerState)
+}
+
+func TestStopDeadlineSimulator(t *testing.T) {
+	ctx := context.Background()
+
+	// a deadline within the power off reserve goes straight to the hard power off
+	base, obj, teardown := simulatorBase(ctx, t)
+
+	var guest guestPrograms
+	guest.start(nil)
+
+	dctx, cancel := context.WithTimeout(ctx, powerOffReserve/5)
+	assert.NoError(t, base.stop(dctx, nil))
+	cancel()
+
+	assert.Empty(t, guest.started())
+	assert.Equal(t, types.VirtualMachinePowerStatePoweredOff, obj.Runtime.PowerState)
+	teardown()
+
+	// a guest that ignores the signals is powered off within the deadline once the graceful phase runs out
+	base, obj, teardown = simulatorBase(ctx, t)
+	defer teardown()
+
+	guest = guestPrograms{}
+	guest.start(nil)
+
+	wait := int32(30)
+	timeout := powerOffReserve + 2*time.Second
+	dctx, cancel = context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	began := time.Now()
+	assert.NoError(t, base.stop(dctx, &wait))
+	assert.True(t, time.Since(began) < timeout, "stop took %s", time.Since(began))
+
+	programs := guest.started()
+	if assert.NotEmpty(t, programs) {
+		assert.Equal(t, "kill TERM", programs[0])
+	}
+	assert.Equal(t, types.VirtualMachinePowerStatePoweredOff, obj.Runtime.PowerState)
+}
+
+func TestShutdownSessionsSimulator(t *testing.T) {
+	ctx := context.Background()
+
+	base, obj, teardown := simulatorBase(ctx, t)
+	defer teardown()
+
+	base.ExecConfig.Sessions["primary"].SignalAll = true
+	for _, id := range []string{"exec1", "exec2"} {
+		base.ExecConfig.Sessions[id] = &executor.SessionConfig{Common: executor.Common{ID: id}}
+	}
+
+	// each session exits on its own signal, and the VM powers off once they all have
+	var mu sync.Mutex
+	exited := make(map[string]bool)
+	var guest guestPrograms
+	guest.start(func(user string, program string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		id := strings.TrimPrefix(program, "kill TERM session:")
+		if id == program || id != user {
+			return
+		}
+		exited[id] = true
+
+		setExtraConfig(obj, map[string]string{
+			extraconfig.CalculateKeys(base.ExecConfig, fmt.Sprintf("Sessions.%s.StartTime", id), "")[0]: "1",
+			extraconfig.CalculateKeys(base.ExecConfig, fmt.Sprintf("Sessions.%s.StopTime", id), "")[0]:  "2",
+		})
+
+		if len(exited) == len(base.ExecConfig.Sessions) {
+			simulatePowerOff(obj)
+		}
+	})
+
+	wait := int32(5)
+	assert.NoError(t, base.stop(ctx, &wait))
+
+	programs := guest.started()
+	sort.Strings(programs)
+	assert.Equal(t, []string{"kill TERM session:exec1", "kill TERM session:exec2", "kill TERM session:primary"}, programs)
+	assert.Equal(t, types.VirtualMachinePowerStatePoweredOff, obj.Runtime.PowerState)
+}
+
+func TestSetStopSignalSimulator(t *testing.T) {
+	ctx := context.Background()
+
+	base, obj, teardown := simulatorBase(ctx, t)
+	defer teardown()
+
+	// setStopSignal reads the config from the VM, so it has to be there already
+	cfg := make(map[string]string)
+	extraconfig.Encode(extraconfig.MapSink(cfg), base.ExecConfig)
+	setExtraConfig(obj, cfg)
+	obj.Config.ChangeVersion = "1"
+
+	applied := extraconfig.CalculateKeys(base.ExecConfig, "AppliedConfigVersion", "")[0]
+	failed := extraconfig.CalculateKeys(base.ExecConfig, "FailedConfigVersion", "")[0]
+	reason := extraconfig.CalculateKeys(base.ExecConfig, "ConfigError", "")[0]
+
+	// the tether applies the change when asked to reload
+	var guest guestPrograms
+	guest.start(func(_ string, program string) {
+		if program == "reload" {
+			setExtraConfig(obj, map[string]string{applied: "1"})
+		}
+	})
+
+	assert.NoError(t, base.setStopSignal(ctx, "primary", "SIGINT"))
+	assert.Equal(t, []string{"reload"}, guest.started())
+	assert.Equal(t, "INT", base.ExecConfig.Sessions["primary"].StopSignal)
+	assert.Equal(t, "1", base.ExecConfig.ConfigVersion)
+
+	// a change the tether rejects is returned rather than left for the next stop to find
+	version := obj.Config.ChangeVersion
+	guest = guestPrograms{}
+	guest.start(func(_ string, program string) {
+		if program == "reload" {
+			setExtraConfig(obj, map[string]string{failed: version, reason: "unsupported signal"})
+		}
+	})
+
+	err := base.setStopSignal(ctx, "primary", "HUP")
+	if assert.IsType(t, ConfigApplyError{}, err) {
+		assert.Equal(t, version, err.(ConfigApplyError).Version)
+		assert.Equal(t, "unsupported signal", err.(ConfigApplyError).Reason)
+	}
+	assert.Equal(t, []string{"reload"}, guest.started())
+}
+
+func TestWaitForAnyPowerStateSimulator(t *testing.T) {
+	ctx := context.Background()
+
+	base, _, teardown := simulatorBase(ctx, t)
+	defer teardown()
+
+	states := []types.VirtualMachinePowerState{
+		types.VirtualMachinePowerStatePoweredOff,
+		types.VirtualMachinePowerStateSuspended,
+	}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		base.vm.WaitForResult(ctx, func(ctx context.Context) (tasks.Task, error) {
+			return base.vm.PowerOff(ctx)
+		})
+	}()
+
+	state, timeout, err := base.waitForAnyPowerState(ctx, 10*time.Second, states...)
+	assert.NoError(t, err)
+	assert.False(t, timeout)
+	assert.Equal(t, types.VirtualMachinePowerStatePoweredOff, state)
+
+	// the timeout reports the state the VM was left in
+	state, timeout, err = base.waitForAnyPowerState(ctx, time.Second, types.VirtualMachinePowerStateSuspended)
+	assert.True(t, timeout)
+	assert.Equal(t, types.VirtualMachinePowerState(""), state)
+	if assert.IsType(t, PowerStateTimeoutError{}, err) {
+		assert.Equal(t, types.VirtualMachinePowerStatePoweredOff, err.(PowerStateTimeoutError).Last)
+	}
+}
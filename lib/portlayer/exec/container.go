@@ -53,12 +53,37 @@ const (
 	StateRemoving
 	StateRemoved
 
-	propertyCollectorTimeout = 3 * time.Minute
-	containerLogName         = "output.log"
+	defaultPropertyCollectorTimeout = 3 * time.Minute
+	containerLogName                = "output.log"
+	consoleLogName                  = "tether.debug"
 
 	vmNotSuspendedKey = "msg.suspend.powerOff.notsuspended"
 )
 
+var pcTimeout = struct {
+	sync.RWMutex
+	d time.Duration
+}{d: defaultPropertyCollectorTimeout}
+
+// SetPropertyCollectorTimeout sets how long operations wait on the property collector for guest updates,
+// e.g. to allow for a slow or remote vCenter. A non-positive duration restores the default.
+func SetPropertyCollectorTimeout(d time.Duration) {
+	if d <= 0 {
+		d = defaultPropertyCollectorTimeout
+	}
+
+	pcTimeout.Lock()
+	defer pcTimeout.Unlock()
+	pcTimeout.d = d
+}
+
+// PropertyCollectorTimeout returns how long operations wait on the property collector for guest updates
+func PropertyCollectorTimeout() time.Duration {
+	pcTimeout.RLock()
+	defer pcTimeout.RUnlock()
+	return pcTimeout.d
+}
+
 func (s State) String() string {
 	switch s {
 	case StateCreated:
@@ -315,7 +340,7 @@ func (c *Container) start(ctx context.Context) error {
 	finalState := c.updateState(StateStarting)
 	defer func() { c.updateState(finalState) }()
 
-	err := c.containerBase.start(ctx)
+	res, err := c.containerBase.start(ctx)
 	if err != nil {
 		// leave this in state starting - if it powers off then the event
 		// will cause transition to StateStopped which is likely our original state
@@ -327,6 +352,7 @@ func (c *Container) start(ctx context.Context) error {
 		return err
 	}
 
+	log.Debugf("container %s started in %s", c.ExecConfig.ID, res.BootDuration)
 	finalState = StateRunning
 
 	return err
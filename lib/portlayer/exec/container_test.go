@@ -16,6 +16,7 @@ package exec
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -56,3 +57,15 @@ func NewContainer(id uid.UID) *Handle {
 
 	return h
 }
+
+func TestPropertyCollectorTimeout(t *testing.T) {
+	defer SetPropertyCollectorTimeout(0)
+
+	assert.Equal(t, defaultPropertyCollectorTimeout, PropertyCollectorTimeout())
+
+	SetPropertyCollectorTimeout(10 * time.Minute)
+	assert.Equal(t, 10*time.Minute, PropertyCollectorTimeout())
+
+	SetPropertyCollectorTimeout(0)
+	assert.Equal(t, defaultPropertyCollectorTimeout, PropertyCollectorTimeout())
+}
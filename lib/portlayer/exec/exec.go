@@ -143,7 +143,7 @@ func eventCallback(ie events.Event) {
 				// container state has changed so we need to update the container attributes
 				// we'll do this in a go routine to avoid blocking
 				go func() {
-					ctx, cancel := context.WithTimeout(context.Background(), propertyCollectorTimeout)
+					ctx, cancel := context.WithTimeout(context.Background(), PropertyCollectorTimeout())
 					defer cancel()
 
 					err := container.Refresh(ctx)
@@ -111,6 +111,10 @@ func newHandle(con *Container) *Handle {
 			VirtualMachineConfigSpec: &types.VirtualMachineConfigSpec{},
 		},
 	}
+	h.logEntry = con.logEntry
+	h.refreshObserver = con.refreshObserver
+	h.startTimeoutPolicy = con.startTimeoutPolicy
+	h.skipStartedWait = con.skipStartedWait
 
 	handlesLock.Lock()
 	defer handlesLock.Unlock()
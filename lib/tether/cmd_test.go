@@ -16,8 +16,12 @@ package tether
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path"
 	"testing"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -220,6 +224,98 @@ func TestHalt(t *testing.T) {
 	}
 }
 
+func TestApplyConfig(t *testing.T) {
+	_, mocker := testSetup(t)
+	defer testTeardown(t, mocker)
+
+	dir, err := ioutil.TempDir("", "applyconfig")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// the session blocks until the marker exists so the config is applied while it's running
+	marker := path.Join(dir, "marker")
+
+	cfg := executor.ExecutorConfig{
+		Common: executor.Common{
+			ID:   "applyconfig",
+			Name: "tether_test_executor",
+		},
+		ConfigVersion: "1",
+
+		Sessions: map[string]*executor.SessionConfig{
+			"applyconfig": &executor.SessionConfig{
+				Common: executor.Common{
+					ID:   "applyconfig",
+					Name: "tether_test_session",
+				},
+				Tty: false,
+				Cmd: executor.Cmd{
+					Path: "/bin/sh",
+					Args: []string{"/bin/sh", "-c", fmt.Sprintf("echo before; while [ ! -e %s ]; do sleep 0.1; done; echo after", marker)},
+					Env:  []string{},
+					Dir:  "/",
+				},
+				StopSignal: "TERM",
+			},
+		},
+	}
+
+	store := extraconfig.New()
+	extraconfig.Encode(store.Put, &cfg)
+
+	Tthr = New(store.Get, store.Put, mocker)
+	Tthr.Register("mocker", mocker)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- Tthr.Start()
+	}()
+
+	// wait for the session to launch
+	result := ExecutorConfig{}
+	for result.AppliedConfigVersion != "1" {
+		time.Sleep(10 * time.Millisecond)
+		extraconfig.Decode(store.Get, &result)
+	}
+
+	// an invalid change is reported rather than acknowledged, and applies nothing
+	cfg.ConfigVersion = "2"
+	cfg.Diagnostics.DebugLevel = 1
+	cfg.Sessions["applyconfig"].StopSignal = "BOGUS"
+	extraconfig.Encode(store.Put, &cfg)
+
+	assert.Error(t, Tthr.ApplyConfig())
+	extraconfig.Decode(store.Get, &result)
+	assert.Equal(t, "1", result.AppliedConfigVersion)
+	assert.Equal(t, "2", result.FailedConfigVersion)
+	assert.NotEmpty(t, result.ConfigError)
+	assert.Equal(t, 0, Tthr.(*tether).config.DebugLevel)
+
+	cfg.ConfigVersion = "3"
+	cfg.Sessions["applyconfig"].StopSignal = "INT"
+	extraconfig.Encode(store.Put, &cfg)
+
+	assert.NoError(t, Tthr.ApplyConfig())
+	extraconfig.Decode(store.Get, &result)
+	assert.Equal(t, "3", result.AppliedConfigVersion)
+	assert.Empty(t, result.FailedConfigVersion)
+	assert.Empty(t, result.ConfigError)
+	assert.Equal(t, 1, Tthr.(*tether).config.DebugLevel)
+	assert.Equal(t, "INT", Tthr.(*tether).config.Sessions["applyconfig"].StopSignal)
+
+	// let the session complete - its output must still reach the session log
+	assert.NoError(t, ioutil.WriteFile(marker, nil, 0644))
+	assert.NoError(t, <-errs)
+
+	assert.Equal(t, "before\nafter\n", mocker.SessionLogBuffer.String())
+
+	// neither reloading nor applying config after the tether has stopped blocks or panics
+	Tthr.Reload()
+	assert.Error(t, Tthr.ApplyConfig())
+}
+
 func TestAbsPathRepeat(t *testing.T) {
 	log.SetLevel(log.WarnLevel)
 
@@ -56,6 +56,17 @@ type ExecutorConfig struct {
 	// Key is the host key used during communicate back with the Interaction endpoint if any
 	// Used if the in-guest tether is responsible for authenticating the connection
 	Key []byte `vic:"0.1" scope:"read-only" key:"key"`
+
+	// ConfigVersion identifies the reconfigure that produced this config
+	ConfigVersion string `vic:"0.1" scope:"read-only" key:"configversion"`
+
+	// AppliedConfigVersion is the ConfigVersion of the last config that was fully applied
+	AppliedConfigVersion string `vic:"0.1" scope:"read-write" key:"appliedconfigversion"`
+
+	// FailedConfigVersion is the ConfigVersion of a config that could not be applied, with ConfigError the
+	// reason. Both are cleared once a config is applied.
+	FailedConfigVersion string `vic:"0.1" scope:"read-write" key:"failedconfigversion"`
+	ConfigError         string `vic:"0.1" scope:"read-write" key:"configerror"`
 }
 
 // SessionConfig defines the content of a session - this maps to the root of a process tree
@@ -97,6 +108,19 @@ type SessionConfig struct {
 	// StopSignal is the signal name or number used to stop a container
 	StopSignal string `vic:"0.1" scope:"read-only" key:"stopSignal"`
 
+	// FreezerPath is the freezer cgroup holding the session processes, if not the default for the session
+	FreezerPath string `vic:"0.1" scope:"read-only" key:"freezerPath"`
+
+	// GuestUser is the username that guest operations for the session authenticate with, in addition to the
+	// session ID
+	GuestUser string `vic:"0.1" scope:"read-only" key:"guestUser"`
+
+	// CleanupCmd is a shell command run on request while the session is being stopped
+	CleanupCmd string `vic:"0.1" scope:"read-only" key:"cleanupCmd"`
+
+	// ShutdownScript is a program run on request as the first step of stopping the session
+	ShutdownScript string `vic:"0.1" scope:"read-only" key:"shutdownScript"`
+
 	// User and group for setuid programs
 	User  string `vic:"0.1" scope:"read-only" key:"user"`
 	Group string `vic:"0.1" scope:"read-only" key:"group"`
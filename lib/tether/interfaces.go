@@ -47,6 +47,7 @@ type Tether interface {
 	Start() error
 	Stop() error
 	Reload()
+	ApplyConfig() error
 	Register(name string, ext Extension)
 }
 
@@ -31,6 +31,7 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 
+	"github.com/vmware/vic/cmd/tether/msgs"
 	"github.com/vmware/vic/lib/system"
 	"github.com/vmware/vic/pkg/dio"
 	"github.com/vmware/vic/pkg/serial"
@@ -56,6 +57,9 @@ type tether struct {
 	// the reload channel is used to block reloading of the config
 	reload chan bool
 
+	// reloadMutex serializes triggering a reload against Stop closing the reload channel
+	reloadMutex sync.Mutex
+
 	// config holds the main configuration for the executor
 	config *ExecutorConfig
 
@@ -182,7 +186,9 @@ func (t *tether) cleanup() {
 	log.SetOutput(os.Stdout)
 
 	// perform basic cleanup
+	t.reloadMutex.Lock()
 	t.reload = nil
+	t.reloadMutex.Unlock()
 	t.ops.Cleanup()
 }
 
@@ -410,6 +416,9 @@ func (t *tether) Start() error {
 			log.Error(err)
 			return err
 		}
+
+		// acknowledge the config so the port layer knows it has been applied
+		t.ackConfig(t.config.ConfigVersion, nil)
 	}
 
 	log.Info("Finished processing sessions")
@@ -420,20 +429,109 @@ func (t *tether) Start() error {
 func (t *tether) Stop() error {
 	defer trace.End(trace.Begin(""))
 
+	// cancel the context to unblock waiters, including any Reload blocked on the reload channel
+	t.cancel()
+
 	// TODO: kill all the children
+	t.reloadMutex.Lock()
+	defer t.reloadMutex.Unlock()
+
 	if t.reload != nil {
 		close(t.reload)
+		t.reload = nil
 	}
 
-	// cancel the context to unblock waiters
-	t.cancel()
 	return nil
 }
 
 func (t *tether) Reload() {
 	log.Infof("Reload triggered")
 
-	t.reload <- true
+	t.reloadMutex.Lock()
+	defer t.reloadMutex.Unlock()
+
+	if t.reload == nil || t.ctx.Err() != nil {
+		log.Warn("Ignoring reload as the tether has stopped")
+		return
+	}
+
+	select {
+	case t.reload <- true:
+	case <-t.ctx.Done():
+		log.Warn("Ignoring reload as the tether has stopped")
+	}
+}
+
+// ApplyConfig re-reads the config and applies the settings that can change while sessions are running,
+// the debug level and session stop signals, then acknowledges the config version. Unlike Reload it
+// doesn't reinitialize or relaunch sessions, so their output and attach streams are left untouched. Other
+// changes are applied by the next reload. A config that can't be applied is reported rather than
+// acknowledged, with none of it applied.
+func (t *tether) ApplyConfig() error {
+	defer trace.End(trace.Begin(""))
+
+	if t.ctx.Err() != nil {
+		return errors.New("tether has stopped")
+	}
+
+	// decode into a scratch config so nothing is applied unless all of it is valid
+	update := &ExecutorConfig{}
+	extraconfig.Decode(t.src, update)
+
+	err := t.applyConfig(update)
+	if err != nil {
+		log.Errorf("Failed to apply config version %s: %s", update.ConfigVersion, err)
+	}
+
+	t.ackConfig(update.ConfigVersion, err)
+	return err
+}
+
+func (t *tether) applyConfig(update *ExecutorConfig) error {
+	for id, session := range update.Sessions {
+		if session.StopSignal == "" {
+			continue
+		}
+
+		sig := new(msgs.SignalMsg)
+		if err := sig.FromString(session.StopSignal); err != nil {
+			return fmt.Errorf("invalid stop signal for session %s: %s", id, err)
+		}
+	}
+
+	for id, session := range t.config.Sessions {
+		s, ok := update.Sessions[id]
+		if !ok {
+			continue
+		}
+
+		session.Lock()
+		if session.StopSignal != s.StopSignal {
+			log.Infof("Changing stop signal of session %s from %q to %q", id, session.StopSignal, s.StopSignal)
+			session.StopSignal = s.StopSignal
+		}
+		session.Unlock()
+	}
+
+	t.config.DebugLevel = update.DebugLevel
+	t.setLogLevel()
+
+	return nil
+}
+
+// ackConfig publishes that the config carrying version has been applied so the port layer knows it has
+// taken effect, or the error that prevented it from being applied
+func (t *tether) ackConfig(version string, err error) {
+	if err != nil {
+		t.config.FailedConfigVersion = version
+		t.config.ConfigError = err.Error()
+	} else {
+		t.config.AppliedConfigVersion = version
+		t.config.FailedConfigVersion = ""
+		t.config.ConfigError = ""
+	}
+
+	extraconfig.Encode(t.sink, t.config)
 }
 
 func (t *tether) Register(name string, extension Extension) {
@@ -579,6 +677,10 @@ func (t *tether) launch(session *SessionConfig) error {
 	// Set the Started key to "true" - this indicates a successful launch
 	session.Started = "true"
 
+	// the attach server checks Started to decide whether the launch is still blocked, so only join the
+	// freezer cgroup once it is set
+	joinFreezer(session)
+
 	// Write the PID to the associated PID file
 	cmdname := path.Base(session.Cmd.Path)
 	err = ioutil.WriteFile(fmt.Sprintf("%s.pid", path.Join(PIDFileDir(), cmdname)),
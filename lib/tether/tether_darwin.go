@@ -77,3 +77,6 @@ func establishPty(session *SessionConfig) error {
 func establishNonPty(session *SessionConfig) error {
 	return errors.New("unimplemented on OSX")
 }
+
+// joinFreezer is a no-op as there is no freezer cgroup on OSX
+func joinFreezer(session *SessionConfig) {}
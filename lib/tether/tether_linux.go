@@ -17,16 +17,21 @@ package tether
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"regexp"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/kr/pty"
 
+	"github.com/vmware/vic/lib/config/executor"
 	"github.com/vmware/vic/pkg/trace"
 )
 
@@ -35,6 +40,14 @@ const (
 	SetChildSubreaper = 0x24
 	pidFilePath       = "var/run"
 
+	// maxExitLogs is the number of exits retained in the exit logs of a restartable session
+	maxExitLogs = 10
+
+	// klogReadAll and klogSizeBuffer are the syslog(2) actions to read the kernel log ring buffer and
+	// return its size
+	klogReadAll    = 3
+	klogSizeBuffer = 10
+
 	// in sync with lib/apiservers/portlayer/handlers/interaction_handler.go
 	// 115200 bps is 14.4 KB/s so use that
 	ioCopyBufferSize = 14 * 1024
@@ -121,6 +134,16 @@ func (t *tether) childReaper() error {
 						session.Lock()
 						session.ExitStatus = status.ExitStatus()
 
+						// the OOM killer uses SIGKILL, so only then is the kernel log checked
+						session.Diagnostics.OOMKilled = status.Signaled() && status.Signal() == syscall.SIGKILL && oomKilled(pid)
+						if session.Diagnostics.OOMKilled {
+							log.Warnf("Process %d of session %s was killed by the OOM killer", pid, session.ID)
+						}
+
+						if session.Restart {
+							recordExit(session, status)
+						}
+
 						t.handleSessionExit(session)
 						session.Unlock()
 					} else {
@@ -136,6 +159,62 @@ func (t *tether) childReaper() error {
 	return nil
 }
 
+// recordExit appends the exit of a restartable session to its exit logs, so the cause of the previous exit
+// is still visible once the session has been relaunched
+func recordExit(session *SessionConfig, status syscall.WaitStatus) {
+	exit := executor.ExitLog{
+		Time:       time.Now(),
+		ExitStatus: status.ExitStatus(),
+		Message:    fmt.Sprintf("exited with %d", status.ExitStatus()),
+	}
+	if status.Signaled() {
+		exit.Signal = int(status.Signal())
+		exit.Message = fmt.Sprintf("killed by %s", status.Signal())
+	}
+	if session.Diagnostics.OOMKilled {
+		exit.Message = "killed by the OOM killer"
+	}
+
+	logs := append(session.Diagnostics.ExitLogs, exit)
+	if len(logs) > maxExitLogs {
+		logs = logs[len(logs)-maxExitLogs:]
+	}
+	session.Diagnostics.ExitLogs = logs
+}
+
+// oomKillMessage matches the kernel log messages of the OOM killer, both global and memory cgroup,
+// capturing the pid of the killed process
+var oomKillMessage = regexp.MustCompile(`(?i)out of memory: kill(?:ed)? process (\d+) `)
+
+// oomKilled reports whether the kernel log records the OOM killer killing the process with the given pid
+func oomKilled(pid int) bool {
+	size, err := syscall.Klogctl(klogSizeBuffer, nil)
+	if err != nil || size <= 0 {
+		log.Warnf("Unable to size kernel log to check for OOM kill of %d: %v", pid, err)
+		return false
+	}
+
+	buf := make([]byte, size)
+	n, err := syscall.Klogctl(klogReadAll, buf)
+	if err != nil {
+		log.Warnf("Unable to read kernel log to check for OOM kill of %d: %s", pid, err)
+		return false
+	}
+
+	return oomKilledIn(string(buf[:n]), pid)
+}
+
+// oomKilledIn reports whether the kernel log klog records the OOM killer killing the process with the
+// given pid
+func oomKilledIn(klog string, pid int) bool {
+	for _, m := range oomKillMessage.FindAllStringSubmatch(klog, -1) {
+		if m[1] == strconv.Itoa(pid) {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *tether) stopReaper() {
 	defer trace.End(trace.Begin("Shutting down child reaping"))
 
@@ -323,3 +402,32 @@ func establishNonPty(session *SessionConfig) error {
 
 	return session.Cmd.Start()
 }
+
+// joinFreezer creates the freezer cgroup of the session if needed and moves the session process into it,
+// so the toolbox can freeze and thaw the session. Processes the session forks from then on inherit the
+// cgroup. Failure is logged rather than failing the launch as the freezer is optional.
+func joinFreezer(session *SessionConfig) {
+	if _, err := os.Stat(freezerRoot); err != nil {
+		log.Debugf("No freezer cgroup hierarchy for session %s: %s", session.ID, err)
+		return
+	}
+
+	dir, err := freezerPath(session)
+	if err != nil {
+		log.Warnf("Unable to add session %s to its freezer cgroup: %s", session.ID, err)
+		return
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		log.Warnf("Unable to create freezer cgroup %s for session %s: %s", dir, session.ID, err)
+		return
+	}
+
+	pid := session.Cmd.Process.Pid
+	if err = ioutil.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		log.Warnf("Unable to add pid %d of session %s to freezer cgroup %s: %s", pid, session.ID, dir, err)
+		return
+	}
+
+	log.Debugf("Added pid %d of session %s to freezer cgroup %s", pid, session.ID, dir)
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tether
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vmware/vic/lib/config/executor"
+)
+
+func TestOOMKilledIn(t *testing.T) {
+	klog := `<6>[   12.345678] eth0: link up
+<3>[  101.000001] Out of memory: Kill process 1234 (stress) score 912 or sacrifice child
+<3>[  101.000002] Killed process 1234 (stress) total-vm:1048576kB, anon-rss:1000000kB, file-rss:0kB
+<3>[  202.000001] Memory cgroup out of memory: Killed process 567 (java) total-vm:2097152kB
+`
+
+	assert.True(t, oomKilledIn(klog, 1234))
+	assert.True(t, oomKilledIn(klog, 567))
+
+	// the pid must match exactly
+	assert.False(t, oomKilledIn(klog, 123))
+	assert.False(t, oomKilledIn(klog, 56))
+	assert.False(t, oomKilledIn("", 1234))
+}
+
+func TestJoinFreezer(t *testing.T) {
+	_, mocker := testSetup(t)
+	defer testTeardown(t, mocker)
+
+	root, err := ioutil.TempDir("", "freezer")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(root)
+
+	defer func(root string) { freezerRoot = root }(freezerRoot)
+	freezerRoot = root
+
+	cfg := executor.ExecutorConfig{
+		Common: executor.Common{
+			ID:   "freezer",
+			Name: "tether_test_executor",
+		},
+
+		Sessions: map[string]*executor.SessionConfig{
+			"freezer": &executor.SessionConfig{
+				Common: executor.Common{
+					ID:   "freezer",
+					Name: "tether_test_session",
+				},
+				Tty: false,
+				Cmd: executor.Cmd{
+					// the shell is the session process, so reports the pid added to the cgroup
+					Path: "/bin/sh",
+					Args: []string{"/bin/sh", "-c", "echo $$"},
+					Env:  []string{},
+					Dir:  "/",
+				},
+			},
+		},
+	}
+
+	_, _, err = RunTether(t, &cfg, mocker)
+	assert.NoError(t, err, "Didn't expected error from RunTether")
+
+	procs, err := ioutil.ReadFile(path.Join(root, "freezer", "cgroup.procs"))
+	if assert.NoError(t, err, "Expected the freezer cgroup of the session to be created") {
+		assert.Equal(t, strings.TrimSpace(mocker.SessionLogBuffer.String()), string(procs))
+	}
+}
@@ -48,3 +48,6 @@ func establishPty(session *SessionConfig) error {
 func establishNonPty(session *SessionConfig) error {
 	return errors.New("unimplemented on windows")
 }
+
+// joinFreezer is a no-op as there is no freezer cgroup on windows
+func joinFreezer(session *SessionConfig) {}
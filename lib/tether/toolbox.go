@@ -19,6 +19,11 @@ package tether
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -30,13 +35,30 @@ import (
 	"github.com/vmware/vic/pkg/vsphere/toolbox"
 )
 
+// freezerRoot is the freezer cgroup hierarchy under which session cgroups are found
+var freezerRoot = "/sys/fs/cgroup/freezer"
+
+// the prefixes of the optional target following the signal in a kill request
+const (
+	sessionTarget = "session:"
+	pidTarget     = "pid:"
+)
+
 // Toolbox is a tether extension that wraps toolbox.Service
 type Toolbox struct {
 	*toolbox.Service
 
+	// ApplyConfig is called to have the tether apply its updated config on request of the port layer
+	ApplyConfig func() error
+
 	sess struct {
 		sync.Mutex
-		session *SessionConfig
+		id       string
+		session  *SessionConfig
+		sessions map[string]*SessionConfig
+
+		// the name the current vix request authenticated with - requests are dispatched serially
+		name string
 	}
 
 	stop chan struct{}
@@ -98,7 +120,13 @@ func (t *Toolbox) Reload(config *ExecutorConfig) error {
 	if config != nil && config.Sessions != nil {
 		t.sess.Lock()
 		defer t.sess.Unlock()
+		t.sess.id = config.ID
 		t.sess.session = config.Sessions[config.ID]
+
+		t.sess.sessions = make(map[string]*SessionConfig, len(config.Sessions))
+		for id, session := range config.Sessions {
+			t.sess.sessions[id] = session
+		}
 	}
 
 	return nil
@@ -121,18 +149,53 @@ func (t *Toolbox) session() *SessionConfig {
 	return t.sess.session
 }
 
+// kill signals the session named by a trailing session:<id> target, or the primary session if no
+// session is named. The request must have authenticated as the session that is signalled.
 func (t *Toolbox) kill(name string) error {
 	session := t.session()
 	if session == nil {
 		return fmt.Errorf("failed to kill container: process not found")
 	}
 
+	id := t.primaryID()
+	if fields := strings.Fields(name); len(fields) == 2 && strings.HasPrefix(fields[1], sessionTarget) {
+		sid := strings.TrimPrefix(fields[1], sessionTarget)
+		s := t.lookup(sid)
+		if s == nil {
+			return fmt.Errorf("failed to kill session %s: session not found", sid)
+		}
+		session, id, name = s, sid, fields[0]
+	}
+
+	if !t.authenticated(id) {
+		return fmt.Errorf("failed to kill session %s: not authenticated as the session", id)
+	}
+
 	session.Lock()
 	defer session.Unlock()
 	return t.killHelper(session, name)
 }
 
 func (t *Toolbox) killHelper(session *SessionConfig, name string) error {
+	// a trailing pid:<n> target requests that the process with that pid is signalled, or with pid:-1
+	// every process other than the tether
+	target := 0
+	if fields := strings.Fields(name); len(fields) == 2 {
+		if !strings.HasPrefix(fields[1], pidTarget) {
+			return fmt.Errorf("invalid kill target %q", fields[1])
+		}
+
+		pid, err := strconv.Atoi(strings.TrimPrefix(fields[1], pidTarget))
+		if err != nil || pid == 0 || pid < -1 {
+			return fmt.Errorf("invalid pid %q", fields[1])
+		}
+		name, target = fields[0], pid
+	}
+
+	// a leading - requests that the process group of the session is signalled
+	group := strings.HasPrefix(name, "-")
+	name = strings.TrimPrefix(name, "-")
+
 	if name == "" {
 		name = string(ssh.SIGTERM)
 	}
@@ -149,6 +212,31 @@ func (t *Toolbox) killHelper(session *SessionConfig, name string) error {
 
 	num := syscall.Signal(sig.Signum())
 
+	if target != 0 {
+		log.Infof("sending signal %s (%d) to pid %d", sig.Signal, num, target)
+
+		// the caller is excluded from a kill of -1
+		if err := syscall.Kill(target, num); err != nil {
+			return fmt.Errorf("failed to signal pid %d: %s", target, err)
+		}
+		return nil
+	}
+
+	if group {
+		pgid, err := syscall.Getpgid(session.Cmd.Process.Pid)
+		if err == nil && pgid != syscall.Getpgrp() {
+			log.Infof("sending signal %s (%d) to process group %d of %s", sig.Signal, num, pgid, session.ID)
+
+			if err := syscall.Kill(-pgid, num); err != nil {
+				return fmt.Errorf("failed to signal process group of %s: %s", session.ID, err)
+			}
+			return nil
+		}
+
+		// never signal our own process group
+		log.Warnf("%s is not a process group leader, signalling the process only", session.ID)
+	}
+
 	log.Infof("sending signal %s (%d) to %s", sig.Signal, num, session.ID)
 
 	if err := session.Cmd.Process.Signal(num); err != nil {
@@ -158,37 +246,248 @@ func (t *Toolbox) killHelper(session *SessionConfig, name string) error {
 	return nil
 }
 
+// primaryID returns the ID of the primary session
+func (t *Toolbox) primaryID() string {
+	t.sess.Lock()
+	defer t.sess.Unlock()
+	return t.sess.id
+}
+
+// lookup returns the session with the given ID, or nil if there is none
+func (t *Toolbox) lookup(id string) *SessionConfig {
+	t.sess.Lock()
+	defer t.sess.Unlock()
+	return t.sess.sessions[id]
+}
+
+// authenticated reports whether the current request authenticated as the session with the given ID, by
+// the session ID or its guest user
+func (t *Toolbox) authenticated(id string) bool {
+	t.sess.Lock()
+	defer t.sess.Unlock()
+
+	if t.sess.name == "" {
+		return false
+	}
+
+	if t.sess.name == id {
+		return true
+	}
+
+	session, ok := t.sess.sessions[id]
+	if !ok {
+		return false
+	}
+
+	session.Lock()
+	defer session.Unlock()
+	return session.GuestUser == t.sess.name
+}
+
 func (t *Toolbox) containerAuthenticate(_ toolbox.VixCommandRequestHeader, data []byte) error {
 	var c toolbox.VixUserCredentialNamePassword
 	if err := c.UnmarshalBinary(data); err != nil {
 		return err
 	}
 
-	session := t.session()
-	if session == nil {
+	if t.session() == nil {
 		return errors.New("not yet initialized")
 	}
 
-	session.Lock()
-	defer session.Unlock()
+	t.sess.Lock()
+	defer t.sess.Unlock()
 
-	// no authentication yet, just using container ID as a sanity check for now
-	if c.Name != session.ID {
-		return errors.New("failed to verify container ID")
+	t.sess.name = ""
+
+	// no authentication yet, just using the container or session ID, or the guest user of a session, as
+	// a sanity check for now
+	if _, ok := t.sess.sessions[c.Name]; ok {
+		t.sess.name = c.Name
+		return nil
 	}
 
-	return nil
+	for _, session := range t.sess.sessions {
+		session.Lock()
+		user := session.GuestUser
+		session.Unlock()
+
+		if user != "" && user == c.Name {
+			t.sess.name = c.Name
+			return nil
+		}
+	}
+
+	return errors.New("failed to verify container ID")
 }
 
 func (t *Toolbox) containerStartCommand(r *toolbox.VixMsgStartProgramRequest) (int, error) {
 	switch r.ProgramPath {
 	case "kill":
 		return -1, t.kill(r.Arguments)
+	case "true":
+		// a no-op, run by the port layer to verify that guest operations reach the tether
+		return -1, nil
+	case "reload":
+		return -1, t.reload()
+	case "freeze":
+		return -1, t.freeze("FROZEN")
+	case "thaw":
+		return -1, t.freeze("THAWED")
+	case "cleanup":
+		return -1, t.cleanup()
+	case "shutdown-script":
+		return -1, t.shutdownScript()
+	case "sync":
+		return -1, t.sync()
 	default:
 		return -1, fmt.Errorf("unknown command %q", r.ProgramPath)
 	}
 }
 
+// reload has the tether apply its config, e.g. after the port layer has updated it, returning once the
+// config is applied
+func (t *Toolbox) reload() error {
+	if t.ApplyConfig == nil {
+		return errors.New("config reload not supported")
+	}
+
+	if !t.authenticated(t.primaryID()) {
+		return errors.New("failed to reload config: not authenticated as the container")
+	}
+
+	log.Info("toolbox: config reload requested")
+
+	return t.ApplyConfig()
+}
+
+// freeze writes state to the freezer cgroup of the primary session
+func (t *Toolbox) freeze(state string) error {
+	session := t.session()
+	if session == nil {
+		return fmt.Errorf("failed to freeze container: not initialized yet")
+	}
+
+	if !t.authenticated(t.primaryID()) {
+		return errors.New("failed to freeze container: not authenticated as the container")
+	}
+
+	session.Lock()
+	dir, err := freezerPath(session)
+	session.Unlock()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("setting freezer state of %s to %s", dir, state)
+
+	if err := ioutil.WriteFile(path.Join(dir, "freezer.state"), []byte(state), 0644); err != nil {
+		return fmt.Errorf("failed to set freezer state of %s: %s", dir, err)
+	}
+
+	return nil
+}
+
+// freezerPath returns the freezer cgroup of the session - the configured path, or by default the cgroup
+// named for the session. Only cgroups within the freezer hierarchy are permitted.
+func freezerPath(session *SessionConfig) (string, error) {
+	if session.FreezerPath == "" {
+		return path.Join(freezerRoot, session.ID), nil
+	}
+
+	dir := path.Clean(session.FreezerPath)
+	if !strings.HasPrefix(dir, freezerRoot+"/") {
+		return "", fmt.Errorf("freezer path %s is not within %s", session.FreezerPath, freezerRoot)
+	}
+
+	return dir, nil
+}
+
+// cleanup starts the cleanup command of the primary session, without waiting for it to complete
+func (t *Toolbox) cleanup() error {
+	session := t.session()
+	if session == nil {
+		return fmt.Errorf("failed to run cleanup: not initialized yet")
+	}
+
+	if !t.authenticated(t.primaryID()) {
+		return errors.New("failed to run cleanup: not authenticated as the container")
+	}
+
+	session.Lock()
+	defer session.Unlock()
+
+	if session.CleanupCmd == "" {
+		return fmt.Errorf("no cleanup command configured for %s", session.ID)
+	}
+
+	return startHelper(session, "/bin/sh", "-c", session.CleanupCmd)
+}
+
+// shutdownScript starts the shutdown script of the primary session, without waiting for it to complete
+func (t *Toolbox) shutdownScript() error {
+	session := t.session()
+	if session == nil {
+		return fmt.Errorf("failed to run shutdown script: not initialized yet")
+	}
+
+	if !t.authenticated(t.primaryID()) {
+		return errors.New("failed to run shutdown script: not authenticated as the container")
+	}
+
+	session.Lock()
+	defer session.Unlock()
+
+	if session.ShutdownScript == "" {
+		return fmt.Errorf("no shutdown script configured for %s", session.ID)
+	}
+
+	return startHelper(session, session.ShutdownScript)
+}
+
+// sync flushes the filesystem caches, returning once the flush is complete
+func (t *Toolbox) sync() error {
+	if t.session() == nil {
+		return fmt.Errorf("failed to sync: not initialized yet")
+	}
+
+	if !t.authenticated(t.primaryID()) {
+		return errors.New("failed to sync: not authenticated as the container")
+	}
+
+	log.Info("toolbox: syncing filesystems")
+
+	syscall.Sync()
+
+	return nil
+}
+
+// startHelper launches the program as the user and with the environment and working directory of the
+// session. It doesn't wait for the program as the tether's child reaper collects it.
+func startHelper(session *SessionConfig, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Env = session.Cmd.Env
+	cmd.Dir = session.Cmd.Dir
+
+	// as with the session itself, but refuse to fall back to running as root
+	if len(session.User) > 0 {
+		cmd.SysProcAttr = getUserSysProcAttr(session.User)
+		if cmd.SysProcAttr == nil {
+			return fmt.Errorf("failed to launch %s for %s: unable to find user %s", name, session.ID, session.User)
+		}
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to launch %s for %s: %s", name, session.ID, err)
+	}
+
+	log.Infof("launched %s for %s (pid: %d)", name, session.ID, cmd.Process.Pid)
+
+	// ignore the error - it's likely raced with the child reaper
+	go cmd.Wait()
+
+	return nil
+}
+
 func (t *Toolbox) halt() error {
 	session := t.session()
 	if session == nil {
@@ -0,0 +1,240 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !windows,!darwin
+
+package tether
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vmware/vic/lib/config/executor"
+	"github.com/vmware/vic/pkg/vsphere/toolbox"
+)
+
+func testToolbox(t *testing.T) *Toolbox {
+	tb := NewToolbox().InContainer()
+
+	config := &ExecutorConfig{
+		ID: "primary",
+		Sessions: map[string]*SessionConfig{
+			"primary": {Common: executor.Common{ID: "primary"}},
+			"exec":    {Common: executor.Common{ID: "exec"}},
+		},
+	}
+
+	assert.NoError(t, tb.Reload(config))
+
+	return tb
+}
+
+func testAuthenticate(tb *Toolbox, name string) error {
+	c := toolbox.VixUserCredentialNamePassword{Name: name}
+	data, _ := c.MarshalBinary()
+
+	return tb.containerAuthenticate(toolbox.VixCommandRequestHeader{}, data)
+}
+
+func TestToolboxKillSession(t *testing.T) {
+	tb := testToolbox(t)
+
+	assert.Error(t, testAuthenticate(tb, "unknown"))
+	assert.NoError(t, testAuthenticate(tb, "exec"))
+
+	// authenticated as the exec session, the primary session can't be signalled
+	err := tb.kill("TERM")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "not authenticated")
+	}
+
+	err = tb.kill("TERM session:primary")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "not authenticated")
+	}
+
+	// the exec session is targeted but has no process
+	err = tb.kill("TERM session:exec")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "hasn't launched yet")
+	}
+
+	// an unknown session is rejected rather than read as a pid or falling back to the primary session
+	err = tb.kill("TERM session:unknown")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "session not found")
+	}
+
+	err = tb.kill("TERM exec")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "not authenticated")
+	}
+
+	assert.NoError(t, testAuthenticate(tb, "primary"))
+
+	err = tb.kill("TERM")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "session primary hasn't launched yet")
+	}
+
+	// a pid must be given as an explicit pid target
+	err = tb.kill("TERM 123")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid kill target")
+	}
+
+	err = tb.kill("TERM pid:0")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid pid")
+	}
+}
+
+func TestToolboxReload(t *testing.T) {
+	tb := testToolbox(t)
+
+	assert.NoError(t, testAuthenticate(tb, "primary"))
+	assert.Error(t, tb.reload())
+
+	applied := 0
+	tb.ApplyConfig = func() error {
+		applied++
+		return nil
+	}
+
+	// only the container can trigger a reload
+	assert.NoError(t, testAuthenticate(tb, "exec"))
+	assert.Error(t, tb.reload())
+
+	assert.NoError(t, testAuthenticate(tb, "primary"))
+	assert.NoError(t, tb.reload())
+	assert.Equal(t, 1, applied)
+
+	// a failure to apply the config fails the request
+	tb.ApplyConfig = func() error {
+		return errors.New("invalid config")
+	}
+	assert.Error(t, tb.reload())
+}
+
+func TestFreezerPath(t *testing.T) {
+	session := &SessionConfig{Common: executor.Common{ID: "abc"}}
+
+	dir, err := freezerPath(session)
+	assert.NoError(t, err)
+	assert.Equal(t, "/sys/fs/cgroup/freezer/abc", dir)
+
+	session.FreezerPath = "/sys/fs/cgroup/freezer/custom/"
+	dir, err = freezerPath(session)
+	assert.NoError(t, err)
+	assert.Equal(t, "/sys/fs/cgroup/freezer/custom", dir)
+
+	session.FreezerPath = "/sys/fs/cgroup/freezer/../../../etc"
+	_, err = freezerPath(session)
+	assert.Error(t, err)
+}
+
+func TestToolboxCleanup(t *testing.T) {
+	tb := testToolbox(t)
+
+	assert.NoError(t, testAuthenticate(tb, "primary"))
+
+	err := tb.cleanup()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no cleanup command")
+	}
+
+	tb.session().CleanupCmd = "true"
+	assert.NoError(t, tb.cleanup())
+}
+
+func TestStartHelperUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("launching as another user requires root")
+	}
+
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no nobody user")
+	}
+
+	dir, err := ioutil.TempDir("", "helper")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.Chmod(dir, 0777))
+
+	session := &SessionConfig{Common: executor.Common{ID: "primary"}, User: "nosuchuser"}
+	session.Cmd.Dir = "/"
+
+	out := path.Join(dir, "uid")
+	cmd := fmt.Sprintf("id -u > %s", out)
+
+	// an unknown user doesn't default to root
+	assert.Error(t, startHelper(session, "/bin/sh", "-c", cmd))
+
+	session.User = "nobody"
+	assert.NoError(t, startHelper(session, "/bin/sh", "-c", cmd))
+
+	var uid []byte
+	for i := 0; i < 100 && len(uid) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		uid, _ = ioutil.ReadFile(out)
+	}
+	assert.Equal(t, nobody.Uid, strings.TrimSpace(string(uid)))
+}
+
+func TestToolboxGuestUser(t *testing.T) {
+	tb := testToolbox(t)
+
+	assert.Error(t, testAuthenticate(tb, "tether"))
+
+	tb.lookup("exec").GuestUser = "tether"
+	assert.NoError(t, testAuthenticate(tb, "tether"))
+
+	// the guest user only vouches for the sessions configured with it
+	assert.True(t, tb.authenticated("exec"))
+	assert.False(t, tb.authenticated("primary"))
+
+	err := tb.kill("TERM session:exec")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "hasn't launched yet")
+	}
+}
+
+func TestToolboxShutdownScript(t *testing.T) {
+	tb := testToolbox(t)
+
+	assert.NoError(t, testAuthenticate(tb, "primary"))
+
+	err := tb.shutdownScript()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no shutdown script")
+	}
+
+	tb.session().ShutdownScript = "/does/not/exist"
+	assert.Error(t, tb.shutdownScript())
+
+	tb.session().ShutdownScript = "/bin/true"
+	assert.NoError(t, tb.shutdownScript())
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+type GuestOperationsManager struct {
+	mo.GuestOperationsManager
+}
+
+func NewGuestOperationsManager(ref types.ManagedObjectReference) object.Reference {
+	m := &GuestOperationsManager{}
+	m.Self = ref
+
+	pm := Map.Put(&GuestProcessManager{}).Reference()
+	m.ProcessManager = &pm
+
+	return m
+}
+
+// GuestProcessManager simulates starting programs in the guest of a powered on VM. No program is run -
+// Start, if set, is called with each request instead so that tests can act on it.
+type GuestProcessManager struct {
+	mo.GuestProcessManager
+
+	// Start returns the pid of the program started in the guest of vm, or the fault to fail the request with
+	Start func(vm types.ManagedObjectReference, auth types.BaseGuestAuthentication, spec types.BaseGuestProgramSpec) (int64, types.BaseMethodFault)
+
+	pid int64
+}
+
+func (m *GuestProcessManager) StartProgramInGuest(req *types.StartProgramInGuest) soap.HasFault {
+	body := &methods.StartProgramInGuestBody{}
+
+	vm, ok := Map.Get(req.Vm).(*VirtualMachine)
+	if !ok {
+		body.Fault_ = Fault("", &types.ManagedObjectNotFound{Obj: req.Vm})
+		return body
+	}
+
+	if vm.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOn {
+		body.Fault_ = Fault("", &types.InvalidPowerState{
+			RequestedState: types.VirtualMachinePowerStatePoweredOn,
+			ExistingState:  vm.Runtime.PowerState,
+		})
+		return body
+	}
+
+	var pid int64
+	if m.Start != nil {
+		var fault types.BaseMethodFault
+		if pid, fault = m.Start(req.Vm, req.Auth, req.Spec); fault != nil {
+			body.Fault_ = Fault("", fault)
+			return body
+		}
+	} else {
+		m.pid++
+		pid = m.pid
+	}
+
+	body.Res = &types.StartProgramInGuestResponse{
+		Returnval: pid,
+	}
+
+	return body
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/guest"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestStartProgramInGuest(t *testing.T) {
+	ctx := context.Background()
+
+	m := ESX()
+	defer m.Remove()
+	err := m.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := m.Service.NewServer()
+	defer s.Close()
+
+	c, err := govmomi.NewClient(ctx, s.URL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err := find.NewFinder(c.Client, false).VirtualMachine(ctx, "/ha-datacenter/vm/*_VM0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pm, err := guest.NewOperationsManager(c.Client, vm.Reference()).ProcessManager(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := &types.NamePasswordAuthentication{Username: "user"}
+	spec := &types.GuestProgramSpec{ProgramPath: "kill", Arguments: "TERM"}
+
+	// the guest is only available while powered on
+	if _, err = pm.StartProgram(ctx, auth, spec); err == nil {
+		t.Error("expected error")
+	}
+
+	task, err := vm.PowerOn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = task.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := pm.StartProgram(ctx, auth, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid != 1 {
+		t.Errorf("pid=%d", pid)
+	}
+
+	var started *types.GuestProgramSpec
+	Map.GuestProcessManager().Start = func(ref types.ManagedObjectReference, a types.BaseGuestAuthentication, s types.BaseGuestProgramSpec) (int64, types.BaseMethodFault) {
+		if ref != vm.Reference() {
+			t.Errorf("vm=%s", ref)
+		}
+
+		if a.(*types.NamePasswordAuthentication).Username != auth.Username {
+			t.Errorf("auth=%#v", a)
+		}
+
+		started = s.GetGuestProgramSpec()
+		if started.ProgramPath == "missing" {
+			return 0, &types.FileNotFound{}
+		}
+		return 42, nil
+	}
+
+	if pid, err = pm.StartProgram(ctx, auth, spec); err != nil {
+		t.Fatal(err)
+	}
+	if pid != 42 || started == nil || started.Arguments != spec.Arguments {
+		t.Errorf("pid=%d spec=%#v", pid, started)
+	}
+
+	if _, err = pm.StartProgram(ctx, auth, &types.GuestProgramSpec{ProgramPath: "missing"}); err == nil {
+		t.Error("expected error")
+	}
+}
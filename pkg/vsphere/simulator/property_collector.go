@@ -19,7 +19,9 @@ import (
 	"log"
 	"path"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/vim25/methods"
@@ -30,8 +32,27 @@ import (
 
 type PropertyCollector struct {
 	mo.PropertyCollector
+
+	// the property values last reported by WaitForUpdatesEx and the version of that report
+	reported map[reportKey]types.AnyType
+	version  int
+}
+
+// reportKey identifies a property of an object collected by a filter
+type reportKey struct {
+	filter types.ManagedObjectReference
+	obj    types.ManagedObjectReference
+	name   string
 }
 
+// maxWaitForUpdates bounds an incremental WaitForUpdatesEx that doesn't specify MaxWaitSeconds, so that
+// a waiting client doesn't hold up closing the server. As when MaxWaitSeconds expires, an empty result is
+// returned, which the client retries.
+var maxWaitForUpdates = time.Second
+
+// waitForUpdatesInterval is how often an incremental WaitForUpdatesEx checks for changes
+const waitForUpdatesInterval = 10 * time.Millisecond
+
 func NewPropertyCollector(ref types.ManagedObjectReference) object.Reference {
 	s := &PropertyCollector{}
 	s.Self = ref
@@ -419,28 +440,55 @@ func (pc *PropertyCollector) RetrieveProperties(r *types.RetrieveProperties) soa
 func (pc *PropertyCollector) WaitForUpdatesEx(r *types.WaitForUpdatesEx) soap.HasFault {
 	body := &methods.WaitForUpdatesExBody{}
 
-	// At the moment we need to support Task completion.  Handlers can simply set the Task
-	// state before returning and the non-incremental update is enough for the client.
-	// We can wait for incremental updates to simulate timeouts, etc.
-	if r.Version != "" {
-		body.Fault_ = Fault("incremental updates not supported yet", &types.NotSupported{})
-		return body
+	// the initial request reports every property, incremental requests wait for a change
+	wait := maxWaitForUpdates
+	if r.Options != nil && r.Options.MaxWaitSeconds > 0 {
+		wait = time.Duration(r.Options.MaxWaitSeconds) * time.Second
 	}
+	deadline := time.Now().Add(wait)
 
-	update := &types.UpdateSet{
-		Version: "-",
+	for {
+		update, fault := pc.update(r.Version == "")
+		if fault != nil {
+			body.Fault_ = Fault("", fault)
+			return body
+		}
+
+		if update != nil || !time.Now().Before(deadline) {
+			body.Res = &types.WaitForUpdatesExResponse{
+				Returnval: update,
+			}
+
+			return body
+		}
+
+		serialize.Unlock()
+		time.Sleep(waitForUpdatesInterval)
+		serialize.Lock()
 	}
+}
+
+// update collects the properties of each filter and returns those that differ from the values last
+// reported, or every property if all is set. nil is returned if nothing has changed.
+func (pc *PropertyCollector) update(all bool) (*types.UpdateSet, types.BaseMethodFault) {
+	if all || pc.reported == nil {
+		pc.reported = make(map[reportKey]types.AnyType)
+	}
+
+	update := &types.UpdateSet{}
 
 	for _, ref := range pc.Filter {
-		filter := Map.Get(ref).(*PropertyFilter)
+		filter, ok := Map.Get(ref).(*PropertyFilter)
+		if !ok {
+			continue
+		}
 
 		r := &types.RetrievePropertiesEx{}
 		r.SpecSet = append(r.SpecSet, filter.Spec)
 
 		res, fault := pc.collect(r)
 		if fault != nil {
-			body.Fault_ = Fault("", fault)
-			return body
+			return nil, fault
 		}
 
 		fu := types.PropertyFilterUpdate{
@@ -450,10 +498,20 @@ func (pc *PropertyCollector) WaitForUpdatesEx(r *types.WaitForUpdatesEx) soap.Ha
 		for _, o := range res.Objects {
 			ou := types.ObjectUpdate{
 				Obj:  o.Obj,
-				Kind: types.ObjectUpdateKindEnter,
+				Kind: types.ObjectUpdateKindModify,
+			}
+
+			if all {
+				ou.Kind = types.ObjectUpdateKindEnter
 			}
 
 			for _, p := range o.PropSet {
+				key := reportKey{ref, o.Obj, p.Name}
+				if val, ok := pc.reported[key]; ok && reflect.DeepEqual(val, p.Val) {
+					continue
+				}
+				pc.reported[key] = p.Val
+
 				ou.ChangeSet = append(ou.ChangeSet, types.PropertyChange{
 					Op:   types.PropertyChangeOpAssign,
 					Name: p.Name,
@@ -461,15 +519,22 @@ func (pc *PropertyCollector) WaitForUpdatesEx(r *types.WaitForUpdatesEx) soap.Ha
 				})
 			}
 
-			fu.ObjectSet = append(fu.ObjectSet, ou)
+			if all || len(ou.ChangeSet) > 0 {
+				fu.ObjectSet = append(fu.ObjectSet, ou)
+			}
 		}
 
-		update.FilterSet = append(update.FilterSet, fu)
+		if all || len(fu.ObjectSet) > 0 {
+			update.FilterSet = append(update.FilterSet, fu)
+		}
 	}
 
-	body.Res = &types.WaitForUpdatesExResponse{
-		Returnval: update,
+	if !all && len(update.FilterSet) == 0 {
+		return nil, nil
 	}
 
-	return body
+	pc.version++
+	update.Version = strconv.Itoa(pc.version)
+
+	return update, nil
 }
@@ -23,6 +23,7 @@ import (
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/methods"
 	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/soap"
 	"github.com/vmware/govmomi/vim25/types"
@@ -276,10 +277,36 @@ func TestWaitForUpdates(t *testing.T) {
 		t.Error(err)
 	}
 
-	// incremental updates not yet suppported
-	err = property.Wait(ctx, pc, folder.Reference(), props, cb(false))
-	if err == nil {
-		t.Error("expected error")
+	// incremental updates report changes made after the initial update
+	obj := Map.Get(folder.Reference()).(*Folder)
+	err = property.Wait(ctx, pc, folder.Reference(), props, func(pc []types.PropertyChange) bool {
+		if len(pc) != 1 {
+			t.Fatalf("changes=%d", len(pc))
+		}
+
+		if pc[0].Val.(string) == folder.Name {
+			obj.Name = "renamed"
+			return false
+		}
+
+		return pc[0].Val.(string) == "renamed"
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	obj.Name = folder.Name
+
+	// an incremental update without changes is empty once the wait expires
+	res, err := methods.WaitForUpdatesEx(ctx, c.Client, &types.WaitForUpdatesEx{
+		This:    c.ServiceContent.PropertyCollector,
+		Version: "1",
+		Options: &types.WaitOptions{MaxWaitSeconds: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Returnval != nil {
+		t.Errorf("unexpected update %#v", res.Returnval)
 	}
 
 	// test object not found
@@ -195,3 +195,9 @@ func (r *Registry) SearchIndex() *SearchIndex {
 func (r *Registry) FileManager() *FileManager {
 	return r.Get(r.content().FileManager.Reference()).(*FileManager)
 }
+
+// GuestProcessManager returns the GuestProcessManager singleton
+func (r *Registry) GuestProcessManager() *GuestProcessManager {
+	m := r.Get(r.content().GuestOperationsManager.Reference()).(*GuestOperationsManager)
+	return r.Get(*m.ProcessManager).(*GuestProcessManager)
+}
@@ -57,6 +57,10 @@ func NewServiceInstance(content types.ServiceContent, folder mo.Folder) *Service
 		NewSearchIndex(*s.Content.SearchIndex),
 	}
 
+	if s.Content.GuestOperationsManager != nil {
+		objects = append(objects, NewGuestOperationsManager(*s.Content.GuestOperationsManager))
+	}
+
 	for _, o := range objects {
 		Map.Put(o)
 	}
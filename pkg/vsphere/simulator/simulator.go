@@ -32,6 +32,7 @@ import (
 	"path"
 	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
@@ -98,7 +99,14 @@ func Fault(msg string, fault types.BaseMethodFault) *soap.Fault {
 	return f
 }
 
+// serialize is held for the duration of each call so that methods are free to read and modify the objects
+// of the Map. A method that blocks, e.g. WaitForUpdatesEx, releases it while waiting.
+var serialize sync.Mutex
+
 func (s *Service) call(method *Method) soap.HasFault {
+	serialize.Lock()
+	defer serialize.Unlock()
+
 	handler := Map.Get(method.This)
 
 	if handler == nil {
@@ -84,6 +84,7 @@ func NewVirtualMachine(spec *types.VirtualMachineConfigSpec) (*VirtualMachine, t
 	}
 
 	vm.Runtime.PowerState = types.VirtualMachinePowerStatePoweredOff
+	vm.Runtime.ConnectionState = types.VirtualMachineConnectionStateConnected
 	vm.Summary.Runtime = vm.Runtime
 
 	err = vm.configure(spec)
@@ -322,6 +323,74 @@ func (vm *VirtualMachine) PowerOffVMTask(c *types.PowerOffVM_Task) soap.HasFault
 	return r
 }
 
+type reconfigVMTask struct {
+	*VirtualMachine
+
+	spec types.VirtualMachineConfigSpec
+}
+
+func (c *reconfigVMTask) Run(task *Task) (types.AnyType, types.BaseMethodFault) {
+	return nil, c.VirtualMachine.reconfigure(&c.spec)
+}
+
+// reconfigure applies the devices and ExtraConfig of a ReconfigVM_Task spec, rejecting a spec with a stale
+// ChangeVersion as vSphere does. An empty value removes the ExtraConfig key. Options are replaced rather
+// than updated in place so property collector waits see the change.
+func (vm *VirtualMachine) reconfigure(spec *types.VirtualMachineConfigSpec) types.BaseMethodFault {
+	if spec.ChangeVersion != "" && spec.ChangeVersion != vm.Config.ChangeVersion {
+		return &types.ConcurrentAccess{}
+	}
+
+	err := vm.configureDevices(spec)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]types.AnyType)
+	var keys []string
+
+	for _, opt := range vm.Config.ExtraConfig {
+		o := opt.GetOptionValue()
+		keys = append(keys, o.Key)
+		values[o.Key] = o.Value
+	}
+
+	for _, opt := range spec.ExtraConfig {
+		o := opt.GetOptionValue()
+		if _, ok := values[o.Key]; !ok {
+			keys = append(keys, o.Key)
+		}
+		values[o.Key] = o.Value
+	}
+
+	var extra []types.BaseOptionValue
+	for _, key := range keys {
+		if v, ok := values[key].(string); values[key] == nil || ok && v == "" {
+			continue
+		}
+
+		extra = append(extra, &types.OptionValue{Key: key, Value: values[key]})
+	}
+
+	vm.Config.ExtraConfig = extra
+	vm.Config.Modified = time.Now()
+	vm.Config.ChangeVersion = vm.Config.Modified.UTC().Format(time.RFC3339Nano)
+
+	return nil
+}
+
+func (vm *VirtualMachine) ReconfigVMTask(req *types.ReconfigVM_Task) soap.HasFault {
+	task := NewTask(&reconfigVMTask{vm, req.Spec})
+
+	task.Run()
+
+	return &methods.ReconfigVM_TaskBody{
+		Res: &types.ReconfigVM_TaskResponse{
+			Returnval: task.Self,
+		},
+	}
+}
+
 type destroyVMTask struct {
 	*VirtualMachine
 }
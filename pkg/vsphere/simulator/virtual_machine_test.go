@@ -24,6 +24,7 @@ import (
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
 )
 
@@ -224,8 +225,11 @@ func TestCreateVm(t *testing.T) {
 						}
 
 					}
-					return false
+					return true
 				})
+				if err != nil {
+					t.Fatal(err)
+				}
 			}
 		}
 
@@ -236,3 +240,68 @@ func TestCreateVm(t *testing.T) {
 		}
 	}
 }
+
+func TestReconfigVm(t *testing.T) {
+	ctx := context.Background()
+
+	m := ESX()
+	defer m.Remove()
+	err := m.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := m.Service.NewServer()
+	defer s.Close()
+
+	c, err := govmomi.NewClient(ctx, s.URL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err := find.NewFinder(c.Client, false).VirtualMachine(ctx, "/ha-datacenter/vm/*_VM0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := func() *types.VirtualMachineConfigInfo {
+		var o mo.VirtualMachine
+		if err := vm.Properties(ctx, vm.Reference(), []string{"config"}, &o); err != nil {
+			t.Fatal(err)
+		}
+		return o.Config
+	}
+
+	reconfigure := func(version string, opts ...types.BaseOptionValue) error {
+		task, err := vm.Reconfigure(ctx, types.VirtualMachineConfigSpec{ExtraConfig: opts, ChangeVersion: version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return task.Wait(ctx)
+	}
+
+	if err = reconfigure("", &types.OptionValue{Key: "foo", Value: "bar"}, &types.OptionValue{Key: "baz", Value: "qux"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config()
+	if len(cfg.ExtraConfig) != 2 || cfg.ExtraConfig[0].GetOptionValue().Value != "bar" {
+		t.Errorf("extraConfig=%#v", cfg.ExtraConfig)
+	}
+
+	// a stale change version is rejected
+	stale := cfg.ChangeVersion
+	if err = reconfigure(stale, &types.OptionValue{Key: "foo", Value: ""}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = reconfigure(stale, &types.OptionValue{Key: "baz", Value: "quux"}); err == nil {
+		t.Error("expected error")
+	}
+
+	// an empty value removes the key
+	cfg = config()
+	if len(cfg.ExtraConfig) != 1 || cfg.ExtraConfig[0].GetOptionValue().Value != "qux" {
+		t.Errorf("extraConfig=%#v", cfg.ExtraConfig)
+	}
+}
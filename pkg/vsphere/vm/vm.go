@@ -22,6 +22,7 @@ import (
 	"net/url"
 	"path"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 
@@ -277,6 +278,49 @@ func (vm *VirtualMachine) WaitForKeyInExtraConfig(ctx context.Context, key strin
 	return detail, nil
 }
 
+// PollForKeyInExtraConfig is WaitForKeyInExtraConfig with the VM polled at the given interval rather
+// than waiting on the property collector
+func (vm *VirtualMachine) PollForKeyInExtraConfig(ctx context.Context, key string, interval time.Duration) (string, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var mvm mo.VirtualMachine
+
+		if err := vm.Properties(ctx, vm.Reference(), []string{"runtime.powerState", "config.extraConfig"}, &mvm); err != nil {
+			log.Errorf("Unable to poll for extra config property %s: %s", key, err.Error())
+			return "", err
+		}
+
+		if mvm.Config != nil {
+			for _, value := range mvm.Config.ExtraConfig {
+				// check the status of the key and return if it's been set to non-nil
+				if key == value.GetOptionValue().Key {
+					detail, _ := value.GetOptionValue().Value.(string)
+					if detail != "" && detail != "<nil>" {
+						return detail, nil
+					}
+					break
+				}
+			}
+		}
+
+		if mvm.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOn {
+			// Give up if the vm has powered off
+			err := fmt.Errorf("runtime.powerState=%s", mvm.Runtime.PowerState)
+			log.Errorf("Unable to poll for extra config property %s: %s", key, err.Error())
+			return "", err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Errorf("Unable to poll for extra config property %s: %s", key, ctx.Err())
+			return "", ctx.Err()
+		}
+	}
+}
+
 func (vm *VirtualMachine) Name(ctx context.Context) (string, error) {
 	var err error
 	var mvm mo.VirtualMachine
@@ -345,6 +389,20 @@ func (vm *VirtualMachine) RemoveSnapshot(ctx context.Context, id types.ManagedOb
 	return object.NewTask(vm.Vim25(), res.Returnval), nil
 }
 
+// RevertToSnapshotByRef reverts the VM to the snapshot with the given reference
+func (vm *VirtualMachine) RevertToSnapshotByRef(ctx context.Context, id types.ManagedObjectReference, suppressPowerOn bool) (*object.Task, error) {
+	req := types.RevertToSnapshot_Task{
+		This:            id,
+		SuppressPowerOn: &suppressPowerOn,
+	}
+	res, err := methods.RevertToSnapshot_Task(ctx, vm.Client.RoundTripper, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.NewTask(vm.Vim25(), res.Returnval), nil
+}
+
 // GetCurrentSnapshotTree returns current snapshot, with tree information
 func (vm *VirtualMachine) GetCurrentSnapshotTree(ctx context.Context) (*types.VirtualMachineSnapshotTree, error) {
 	var err error
@@ -358,6 +358,58 @@ func TestWaitForKeyInExtraConfig(t *testing.T) {
 	}
 }
 
+func TestPollForKeyInExtraConfig(t *testing.T) {
+	ctx := context.Background()
+
+	m := simulator.ESX()
+	defer m.Remove()
+	err := m.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := m.Service.NewServer()
+	defer server.Close()
+
+	config := &session.Config{
+		Service: server.URL.String(),
+	}
+
+	s, err := session.NewSession(config).Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err = s.Populate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	vms, err := s.Finder.VirtualMachineList(ctx, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := NewVirtualMachineFromVM(ctx, s, vms[0])
+
+	opt := &types.OptionValue{Key: "foo", Value: "bar"}
+	obj := simulator.Map.Get(vm.Reference()).(*simulator.VirtualMachine)
+	obj.Config.ExtraConfig = append(obj.Config.ExtraConfig, opt)
+
+	val, err := vm.PollForKeyInExtraConfig(ctx, "missing", 10*time.Millisecond)
+	if err == nil {
+		t.Error("expected error")
+	}
+
+	val, err = vm.PollForKeyInExtraConfig(ctx, opt.Key, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if val != opt.Value {
+		t.Errorf("%s != %s", val, opt.Value)
+	}
+}
+
 func createSnapshotTree(prefix string, deep int, wide int) []types.VirtualMachineSnapshotTree {
 	var result []types.VirtualMachineSnapshotTree
 	if deep == 0 {